@@ -0,0 +1,45 @@
+package action
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+)
+
+// WithArgCopy snapshots the args of every task with copyFn when it is submitted, before it is queued: a caller
+// mutating the data it passed by pointer afterwards does not race with the task anymore.
+// When copyFn fails, a synchronous send returns its error and an asynchronous task is discarded with it, without
+// being executed. GobCopy is a generic deep copy to use as copyFn.
+func WithArgCopy(copyFn func(args interface{}) (interface{}, error)) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.argCopy = copyFn
+	}
+}
+
+// GobCopy returns a deep copy of args made by encoding it with encoding/gob, with the same type. A pointer is
+// copied as a pointer to a copy of the pointed value. Only the exported fields are copied.
+// Returns an error matching ErrArgsCopy if args cannot be encoded with gob, a channel, a function or a struct
+// without exported field for instance.
+func GobCopy(args interface{}) (interface{}, error) {
+	if args == nil {
+		return nil, nil
+	}
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArgsCopy, err)
+	}
+	argsType := reflect.TypeOf(args)
+	pointer := argsType.Kind() == reflect.Ptr
+	if pointer {
+		argsType = argsType.Elem()
+	}
+	copied := reflect.New(argsType)
+	if err := gob.NewDecoder(&buffer).DecodeValue(copied); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArgsCopy, err)
+	}
+	if pointer {
+		return copied.Interface(), nil
+	}
+	return copied.Elem().Interface(), nil
+}
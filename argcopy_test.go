@@ -0,0 +1,103 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+type subscriptionArgs struct {
+	Theme string
+	Names []string
+}
+
+func Test_ShouldSnapshotTheArgsOnSubmission(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithArgCopy(action.GobCopy),
+		action.WithQueueSize(1))
+	release := blockHandler(actionHandler)
+
+	args := &subscriptionArgs{Theme: "theme 0", Names: []string{"Name 0"}}
+	seen := make(chan subscriptionArgs, 1)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		seen <- *args.(*subscriptionArgs)
+		return nil, nil
+	}, args)
+	// Mutate the original once submitted but before the task runs
+	args.Theme = "theme 1"
+	args.Names[0] = "Someone else"
+	release()
+
+	assert.DeepEqual(t, <-seen, subscriptionArgs{Theme: "theme 0", Names: []string{"Name 0"}})
+}
+
+func Test_ShouldCopyValuesAndPointersWithGob(t *testing.T) {
+	value := subscriptionArgs{Theme: "theme 0", Names: []string{"Name 0"}}
+	copied, err := action.GobCopy(value)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, copied, value)
+	copied.(subscriptionArgs).Names[0] = "Someone else"
+	assert.Equal(t, value.Names[0], "Name 0")
+
+	pointer := &value
+	copiedPointer, err := action.GobCopy(pointer)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, copiedPointer, pointer)
+	assert.Assert(t, copiedPointer.(*subscriptionArgs) != pointer)
+
+	copied, err = action.GobCopy(42)
+	assert.NilError(t, err)
+	assert.Equal(t, copied, 42)
+	copied, err = action.GobCopy(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, copied, nil)
+}
+
+// unexportedArgs cannot be copied with gob, having no exported field
+type unexportedArgs struct {
+	theme string
+}
+
+func Test_ShouldReturnTheArgsCopyErrorInsteadOfPanicking(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithArgCopy(action.GobCopy))
+	executed := false
+	task := func(interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}
+
+	_, err := action.GobCopy(unexportedArgs{theme: "theme 0"})
+	assert.Assert(t, errors.Is(err, action.ErrArgsCopy))
+	_, err = actionHandler.SynchronousActionSend(task, unexportedArgs{theme: "theme 0"})
+	assert.Assert(t, errors.Is(err, action.ErrArgsCopy))
+
+	// An asynchronous task is discarded with the copy error
+	discarded := make(chan error)
+	actionHandler.AsynchronousActionSendCallback(task, unexportedArgs{theme: "theme 0"}, func(_ interface{}, err error) {
+		discarded <- err
+	})
+	assert.Assert(t, errors.Is(<-discarded, action.ErrArgsCopy))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, !executed)
+}
+
+func Test_ShouldCopyTheArgsOfSynchronousSends(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithArgCopy(action.GobCopy))
+
+	args := &subscriptionArgs{Theme: "theme 0"}
+	result, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, args)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, args)
+	assert.Assert(t, result.(*subscriptionArgs) != args)
+}
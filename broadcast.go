@@ -0,0 +1,24 @@
+package action
+
+import (
+	"sync"
+)
+
+// SendToAll sends the same task to all the handlers concurrently, in a synchronous way.
+// Each handler executes the task in its own thread-safe context, independently of the others: a stopped handler
+// only fails its own send.
+// Returns the results and errors indexed like the handlers
+func SendToAll(handlers []*ThreadSafeActionHandler, threadSafeTask ThreadSafeTask, args interface{}) ([]interface{}, []error) {
+	results := make([]interface{}, len(handlers))
+	errs := make([]error, len(handlers))
+	var wg sync.WaitGroup
+	wg.Add(len(handlers))
+	for i, handler := range handlers {
+		go func(i int, handler *ThreadSafeActionHandler) {
+			defer wg.Done()
+			results[i], errs[i] = handler.SynchronousActionSend(threadSafeTask, args)
+		}(i, handler)
+	}
+	wg.Wait()
+	return results, errs
+}
@@ -0,0 +1,77 @@
+package action_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldGatherTheResultsOfAllHandlersInOrder(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+
+	// Each handler is kept busy until its gate is released
+	nbHandlers := 3
+	handlers := make([]*action.ThreadSafeActionHandler, nbHandlers)
+	gates := make([]chan bool, nbHandlers)
+	for i := range handlers {
+		handlers[i] = action.NewThreadSafeActionHandler(handlerCtx)
+		gates[i] = make(chan bool)
+		gate := gates[i]
+		handlers[i].AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+			<-gate
+			return nil, nil
+		}, nil)
+	}
+	var nbExecutions int32
+	broadcastDone := make(chan bool)
+	var results []interface{}
+	var errs []error
+	go func() {
+		results, errs = action.SendToAll(handlers, func(args interface{}) (interface{}, error) {
+			return atomic.AddInt32(&nbExecutions, 1), nil
+		}, nil)
+		close(broadcastDone)
+	}()
+	// Release the handlers from the last to the first one
+	for i := nbHandlers - 1; i >= 0; i-- {
+		close(gates[i])
+		for atomic.LoadInt32(&nbExecutions) != int32(nbHandlers-i) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	<-broadcastDone
+
+	assert.Equal(t, len(errs), nbHandlers)
+	for i := range handlers {
+		assert.NilError(t, errs[i])
+	}
+	// The results are indexed like the handlers, whatever the execution order
+	assert.DeepEqual(t, results, []interface{}{int32(3), int32(2), int32(1)})
+}
+
+func Test_ShouldSendToAllHandlersIndependently(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	stoppedCtx, stopHandler := context.WithCancel(context.TODO())
+	stopHandler()
+
+	handlers := []*action.ThreadSafeActionHandler{
+		action.NewThreadSafeActionHandler(handlerCtx),
+		action.NewThreadSafeActionHandler(stoppedCtx),
+		action.NewThreadSafeActionHandler(handlerCtx),
+	}
+	results, errs := action.SendToAll(handlers, func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, 1234)
+
+	assert.DeepEqual(t, results, []interface{}{1234, nil, 1234})
+	assert.NilError(t, errs[0])
+	assert.Error(t, errs[1], "context canceled")
+	assert.NilError(t, errs[2])
+}
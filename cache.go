@@ -0,0 +1,42 @@
+package action
+
+import (
+	"context"
+	"time"
+)
+
+// cachedResult is a task result cached by SynchronousActionSendCached until expiresAt
+type cachedResult struct {
+	result    interface{}
+	expiresAt time.Time
+}
+
+// SynchronousActionSendCached sends an action to the thread-safe action handler in a synchronous way, returning the
+// result cached for key if a previous call with the same key has succeeded less than ttl ago instead of executing
+// the task again. It suits expensive tasks whose result only depends on key. The errors are not cached.
+// The cache is maintained by the thread-safe tasks: a cached result is still returned in order with the other
+// tasks. An expired result is dropped once its key is sent again. See SynchronousActionSend.
+func (h *ThreadSafeActionHandler) SynchronousActionSendCached(key string, ttl time.Duration, threadSafeTask ThreadSafeTask,
+	args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.synchronousSend(h.handlerCtx(), func(_ context.Context, args interface{}) (interface{}, error) {
+		now := time.Now()
+		if cached, exists := h.cache[key]; exists {
+			if now.Before(cached.expiresAt) {
+				return cached.result, nil
+			}
+			delete(h.cache, key)
+		}
+		result, err := threadSafeTask(args)
+		if err != nil {
+			return nil, err
+		}
+		if h.cache == nil {
+			h.cache = map[string]cachedResult{}
+		}
+		h.cache[key] = cachedResult{result: result, expiresAt: now.Add(ttl)}
+		return result, nil
+	}, args, false)
+}
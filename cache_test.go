@@ -0,0 +1,62 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldExecuteACachedTaskOnceWithinTheTTL(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	executions := 0
+	square := func(args interface{}) (interface{}, error) {
+		executions++
+		return args.(int) * args.(int), nil
+	}
+	for i := 0; i < 3; i++ {
+		result, err := actionHandler.SynchronousActionSendCached("square 3", time.Hour, square, 3)
+		assert.NilError(t, err)
+		assert.Equal(t, result, 9)
+	}
+	assert.Equal(t, executions, 1)
+	result, err := actionHandler.SynchronousActionSendCached("square 4", time.Hour, square, 4)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 16)
+	assert.Equal(t, executions, 2)
+
+	// Once the TTL has elapsed, the task is executed again
+	ttl := 10 * time.Millisecond
+	_, err = actionHandler.SynchronousActionSendCached("square 5", ttl, square, 5)
+	assert.NilError(t, err)
+	time.Sleep(ttl)
+	result, err = actionHandler.SynchronousActionSendCached("square 5", ttl, square, 5)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 25)
+	assert.Equal(t, executions, 4)
+}
+
+func Test_ShouldNotCacheTheTaskErrors(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	executions := 0
+	failure := errors.New("failure")
+	failing := func(interface{}) (interface{}, error) {
+		executions++
+		return nil, failure
+	}
+	for i := 0; i < 2; i++ {
+		_, err := actionHandler.SynchronousActionSendCached("key", time.Hour, failing, nil)
+		assert.Assert(t, errors.Is(err, failure))
+	}
+	assert.Equal(t, executions, 2)
+}
@@ -0,0 +1,88 @@
+package action
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops the execution of the tasks of a class failing repeatedly, see WithCircuitBreaker.
+// Its methods are called concurrently: Allow from the sending goroutines, Record from the handler loop.
+type CircuitBreaker interface {
+	// Allow tells whether a task of class may be sent
+	Allow(class string) bool
+	// Record is called with the error of each executed task of class, nil on success
+	Record(class string, err error)
+}
+
+// WithCircuitBreaker guards the tasks sent with a class, see WithClass, with breaker: the sends of a class the
+// breaker does not allow are rejected, SynchronousActionSendWithOptions returning ErrCircuitOpen and
+// AsynchronousActionSendWithOptions ignoring the task, as it does once the handler is closed. The tasks already
+// queued are executed. The tasks sent without class are not guarded.
+func WithCircuitBreaker(breaker CircuitBreaker) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.breaker = breaker
+	}
+}
+
+// allowClass tells whether the circuit breaker, if any, allows the action to be sent
+func (h *ThreadSafeActionHandler) allowClass(ctrl *ctrlAction) bool {
+	return h.breaker == nil || ctrl.class == "" || h.breaker.Allow(ctrl.class)
+}
+
+// recordClass reports the outcome of an executed action to the circuit breaker, if any
+func (h *ThreadSafeActionHandler) recordClass(ctrl *ctrlAction, err error) {
+	if h.breaker != nil && ctrl.class != "" && !ctrl.internal {
+		h.breaker.Record(ctrl.class, err)
+	}
+}
+
+// circuitState is the state of the circuit of a class
+type circuitState struct {
+	failures int
+	openedAt time.Time
+}
+
+// ThresholdCircuitBreaker opens the circuit of a class once its tasks have failed threshold times in a row, and
+// closes it again once cooldown has elapsed: the next sends are allowed, the first failure reopening the circuit for
+// another cooldown and the first success resetting it.
+type ThresholdCircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	mutex     sync.Mutex
+	circuits  map[string]*circuitState
+}
+
+// NewThresholdCircuitBreaker creates a new ThresholdCircuitBreaker. A threshold lower than 1 defaults to 1.
+func NewThresholdCircuitBreaker(threshold int, cooldown time.Duration) *ThresholdCircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &ThresholdCircuitBreaker{threshold: threshold, cooldown: cooldown, circuits: map[string]*circuitState{}}
+}
+
+// Allow tells whether the circuit of class is closed
+func (b *ThresholdCircuitBreaker) Allow(class string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	circuit, exists := b.circuits[class]
+	return !exists || circuit.failures < b.threshold || time.Since(circuit.openedAt) >= b.cooldown
+}
+
+// Record counts the consecutive failures of the tasks of class
+func (b *ThresholdCircuitBreaker) Record(class string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		delete(b.circuits, class)
+		return
+	}
+	circuit, exists := b.circuits[class]
+	if !exists {
+		circuit = &circuitState{}
+		b.circuits[class] = circuit
+	}
+	circuit.failures++
+	if circuit.failures >= b.threshold {
+		circuit.openedAt = time.Now()
+	}
+}
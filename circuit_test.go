@@ -0,0 +1,102 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldShortCircuitAFailingTaskClassUntilTheCooldownElapses(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	cooldown := 50 * time.Millisecond
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx,
+		action.WithCircuitBreaker(action.NewThresholdCircuitBreaker(3, cooldown)))
+
+	failing := true
+	executions := 0
+	task := func(interface{}) (interface{}, error) {
+		executions++
+		if failing {
+			return nil, errors.New("backend down")
+		}
+		return "ok", nil
+	}
+	for i := 0; i < 3; i++ {
+		_, err := actionHandler.SynchronousActionSendWithOptions(task, nil, action.WithClass("backend"))
+		assert.ErrorContains(t, err, "backend down")
+	}
+	openedAt := time.Now()
+
+	// The circuit is open: the sends of the class are rejected without executing the task
+	_, err := actionHandler.SynchronousActionSendWithOptions(task, nil, action.WithClass("backend"))
+	assert.Assert(t, errors.Is(err, action.ErrCircuitOpen))
+	actionHandler.AsynchronousActionSendWithOptions(task, nil, action.WithClass("backend"))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, executions, 3)
+	// The other classes are not guarded by the circuit of the class
+	_, err = actionHandler.SynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil, action.WithClass("other"))
+	assert.NilError(t, err)
+
+	// Once the cooldown has elapsed, the first success closes the circuit
+	time.Sleep(cooldown - time.Since(openedAt))
+	failing = false
+	result, err := actionHandler.SynchronousActionSendWithOptions(task, nil, action.WithClass("backend"))
+	assert.NilError(t, err)
+	assert.Equal(t, result, "ok")
+	failing = true
+	_, err = actionHandler.SynchronousActionSendWithOptions(task, nil, action.WithClass("backend"))
+	assert.ErrorContains(t, err, "backend down")
+	assert.Equal(t, executions, 5)
+}
+
+func Test_ShouldReopenTheCircuitOnTheFirstFailureAfterTheCooldown(t *testing.T) {
+	cooldown := 20 * time.Millisecond
+	breaker := action.NewThresholdCircuitBreaker(2, cooldown)
+	failure := errors.New("failure")
+	breaker.Record("class", failure)
+	assert.Assert(t, breaker.Allow("class"))
+	breaker.Record("class", failure)
+	assert.Assert(t, !breaker.Allow("class"))
+	assert.Assert(t, breaker.Allow("other"))
+
+	time.Sleep(cooldown)
+	assert.Assert(t, breaker.Allow("class"))
+	breaker.Record("class", failure)
+	assert.Assert(t, !breaker.Allow("class"))
+}
+
+func Test_ShouldReportTheAsynchronousTasksRejectedByAnOpenCircuit(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	type rejection struct {
+		args   interface{}
+		reason action.DiscardReason
+	}
+	rejected := make(chan rejection, 1)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx,
+		action.WithCircuitBreaker(action.NewThresholdCircuitBreaker(1, time.Minute)),
+		action.WithDeadLetter(func(_ action.ThreadSafeTask, args interface{}, reason action.DiscardReason) {
+			rejected <- rejection{args: args, reason: reason}
+		}))
+
+	_, err := actionHandler.SynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+		return nil, errors.New("backend down")
+	}, nil, action.WithClass("backend"))
+	assert.ErrorContains(t, err, "backend down")
+
+	actionHandler.AsynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, "rejected", action.WithClass("backend"))
+	got := <-rejected
+	assert.Equal(t, got.args, "rejected")
+	assert.Equal(t, got.reason, action.ReasonCircuitOpen)
+	assert.Equal(t, got.reason.String(), "circuit open")
+}
@@ -0,0 +1,70 @@
+package action
+
+import (
+	"context"
+	"sync"
+)
+
+// coalescedTask is the single task executed for all the coalesced sends of a key queued at the same time
+type coalescedTask struct {
+	// task and args are the ones of the latest send, until the task is started
+	task ThreadSafeTask
+	args interface{}
+	// result and err are set before done is closed
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+// coalescer tracks the coalesced tasks queued by key
+type coalescer struct {
+	mutex  sync.Mutex
+	queued map[string]*coalescedTask
+}
+
+// SynchronousActionSendCoalesced sends an action to the thread-safe action handler in a synchronous way, coalescing
+// it with the task of the same key already queued if any: only the latest task is executed, with the latest args,
+// and its result is returned to every coalesced caller. Once the task is started, the next sends of the key queue a
+// new task. It suits idempotent tasks, which only need to be executed once for all the requests queued meanwhile.
+// Like SynchronousActionSend, it must not be called from a task of the same handler, which would deadlock.
+func (h *ThreadSafeActionHandler) SynchronousActionSendCoalesced(key string, threadSafeTask ThreadSafeTask, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	args, err := h.copyArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	h.coalescer.mutex.Lock()
+	if queued, exists := h.coalescer.queued[key]; exists {
+		queued.task, queued.args = threadSafeTask, args
+		h.coalescer.mutex.Unlock()
+		<-queued.done
+		return queued.result, queued.err
+	}
+	queued := &coalescedTask{task: threadSafeTask, args: args, done: make(chan struct{})}
+	if h.coalescer.queued == nil {
+		h.coalescer.queued = map[string]*coalescedTask{}
+	}
+	h.coalescer.queued[key] = queued
+	h.coalescer.mutex.Unlock()
+
+	queued.result, queued.err = h.synchronousSend(h.handlerCtx(), func(context.Context, interface{}) (interface{}, error) {
+		task, args := h.coalescer.start(key, queued)
+		return task(args)
+	}, nil, false)
+	// The task may have been discarded without being started
+	h.coalescer.start(key, queued)
+	close(queued.done)
+	return queued.result, queued.err
+}
+
+// start stops coalescing the sends of key with queued, and returns the task to execute
+func (c *coalescer) start(key string, queued *coalescedTask) (ThreadSafeTask, interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.queued[key] == queued {
+		delete(c.queued, key)
+	}
+	return queued.task, queued.args
+}
@@ -0,0 +1,83 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldExecuteTheCoalescedTasksOfAKeyOnce(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	release := blockHandler(actionHandler)
+
+	executions := 0
+	recount := func(args interface{}) (interface{}, error) {
+		executions++
+		return args, nil
+	}
+	nbRequests := 100
+	results := make(chan interface{}, nbRequests)
+	var sent sync.WaitGroup
+	for i := 0; i < nbRequests; i++ {
+		sent.Add(1)
+		go func(i int) {
+			sent.Done()
+			result, err := actionHandler.SynchronousActionSendCoalesced("recount theme X", recount, i)
+			if err != nil {
+				result = err
+			}
+			results <- result
+		}(i)
+	}
+	sent.Wait()
+	// Let the requests queue up behind the blocked handler loop
+	time.Sleep(20 * time.Millisecond)
+	release()
+
+	distinct := map[interface{}]bool{}
+	for i := 0; i < nbRequests; i++ {
+		result := <-results
+		_, isInt := result.(int)
+		assert.Assert(t, isInt, "unexpected result %v", result)
+		distinct[result] = true
+	}
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, executions < nbRequests/10, "%d executions", executions)
+	// The callers share the results of the executed tasks
+	assert.Equal(t, len(distinct), executions)
+
+	// Once executed, the next send of the key executes the task again
+	result, err := actionHandler.SynchronousActionSendCoalesced("recount theme X", recount, "again")
+	assert.NilError(t, err)
+	assert.Equal(t, result, "again")
+}
+
+func Test_ShouldNotCoalesceTheTasksOfDifferentKeys(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	taskErr := errors.New("task error")
+
+	var executed []interface{}
+	_, err := actionHandler.SynchronousActionSendCoalesced("key 1", recordTask(&executed), 1)
+	assert.NilError(t, err)
+	_, err = actionHandler.SynchronousActionSendCoalesced("key 2", func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, 2)
+	assert.Assert(t, errors.Is(err, taskErr))
+	_, err = actionHandler.SynchronousActionSendCoalesced("key 1", nil, 1)
+	assert.Equal(t, err, action.ErrNilTask)
+	assert.DeepEqual(t, executed, []interface{}{1})
+
+	assert.NilError(t, actionHandler.Close())
+	_, err = actionHandler.SynchronousActionSendCoalesced("key 1", recordTask(&executed), 3)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerClosed))
+}
@@ -0,0 +1,65 @@
+package action
+
+import (
+	"errors"
+)
+
+// DiscardReason tells why a task has been discarded without being executed
+type DiscardReason int
+
+const (
+	// ReasonContextCancelled is reported for the tasks discarded because the handler context is done, the handler
+	// being stopped before executing them
+	ReasonContextCancelled DiscardReason = iota
+	// ReasonQueueFull is reported for the tasks rejected or evicted by the full queue policy, see
+	// WithFullQueuePolicy
+	ReasonQueueFull
+	// ReasonTaskCancelled is reported for the tasks cancelled before being started, see
+	// AsynchronousActionSendCancelable
+	ReasonTaskCancelled
+	// ReasonCircuitOpen is reported for the tasks rejected by the circuit breaker of their class, see
+	// WithCircuitBreaker
+	ReasonCircuitOpen
+)
+
+func (r DiscardReason) String() string {
+	switch r {
+	case ReasonQueueFull:
+		return "queue full"
+	case ReasonTaskCancelled:
+		return "task cancelled"
+	case ReasonCircuitOpen:
+		return "circuit open"
+	default:
+		return "context cancelled"
+	}
+}
+
+// WithDeadLetter calls onDiscard with every asynchronous task accepted by the handler but discarded without being
+// executed, or rejected by an open circuit, and the reason why. The tasks sent once the handler is closed are
+// rejected, not discarded: they are not reported. Synchronous tasks are not reported either, their caller getting the error.
+// onDiscard is called from its own goroutine so it never blocks the handler loop.
+func WithDeadLetter(onDiscard func(task ThreadSafeTask, args interface{}, reason DiscardReason)) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.onDeadLetter = func(_ string, task ThreadSafeTask, args interface{}, reason DiscardReason) {
+			onDiscard(task, args, reason)
+		}
+	}
+}
+
+// deadLetter reports a discarded asynchronous task to the dead-letter hook, if any
+func (h *ThreadSafeActionHandler) deadLetter(ctrl *ctrlAction, err error) {
+	if h.onDeadLetter == nil || ctrl.sync || ctrl.ctrlThreadSafeCtx.task == nil {
+		return
+	}
+	reason := ReasonContextCancelled
+	switch {
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrTaskDropped):
+		reason = ReasonQueueFull
+	case errors.Is(err, ErrTaskCancelled):
+		reason = ReasonTaskCancelled
+	case errors.Is(err, ErrCircuitOpen):
+		reason = ReasonCircuitOpen
+	}
+	go h.onDeadLetter(ctrl.id, ctrl.ctrlThreadSafeCtx.task, ctrl.ctrlThreadSafeCtx.args, reason)
+}
@@ -0,0 +1,81 @@
+package action_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+type deadLetter struct {
+	args   interface{}
+	reason action.DiscardReason
+}
+
+// collectDeadLetters returns a dead-letter hook sending the discarded tasks on the returned channel
+func collectDeadLetters() (func(action.ThreadSafeTask, interface{}, action.DiscardReason), <-chan deadLetter) {
+	letters := make(chan deadLetter, 10)
+	return func(task action.ThreadSafeTask, args interface{}, reason action.DiscardReason) {
+		letters <- deadLetter{args: args, reason: reason}
+	}, letters
+}
+
+func Test_ShouldReportTheQueuedTasksDiscardedOnceTheContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	onDiscard, letters := collectDeadLetters()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(3),
+		action.WithDeadLetter(onDiscard))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	cancelHandler()
+	release()
+	<-actionHandler.Done()
+
+	var discarded []int
+	for i := 0; i < 3; i++ {
+		letter := <-letters
+		assert.Equal(t, letter.reason, action.ReasonContextCancelled)
+		discarded = append(discarded, letter.args.(int))
+	}
+	sort.Ints(discarded)
+	assert.DeepEqual(t, discarded, []int{1, 2, 3})
+	assert.Equal(t, len(executed), 0)
+}
+
+func Test_ShouldReportTheTasksDiscardedByTheFullQueuePolicyOrCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	onDiscard, letters := collectDeadLetters()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(1),
+		action.WithFullQueuePolicy(action.QueueDropNewest), action.WithDeadLetter(onDiscard))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	cancel := actionHandler.AsynchronousActionSendCancelable(recordTask(&executed), 1)
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 2)
+	assert.Equal(t, <-letters, deadLetter{args: 2, reason: action.ReasonQueueFull})
+	assert.Assert(t, cancel())
+	release()
+	assert.Equal(t, <-letters, deadLetter{args: 1, reason: action.ReasonTaskCancelled})
+
+	// Synchronous tasks are not reported, nor the tasks sent once the handler is closed
+	assert.NilError(t, actionHandler.Close())
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 3)
+	_, err := actionHandler.SynchronousActionSend(recordTask(&executed), 4)
+	assert.ErrorContains(t, err, "closed")
+	select {
+	case letter := <-letters:
+		t.Fatalf("unexpected dead letter %v", letter)
+	default:
+	}
+	assert.Equal(t, len(executed), 0)
+	assert.Equal(t, action.ReasonQueueFull.String(), "queue full")
+}
@@ -0,0 +1,60 @@
+package action
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ScheduleAfter queues task to be executed with args right after the running task and its previously scheduled
+// follow-ups, before any other queued task. It lets a task schedule follow-up work on its own handler, which it
+// cannot wait for without deadlocking, see ErrReentrantSend. The follow-up is executed like an asynchronous task,
+// or discarded once the handler context is done. It receives its own task context, so that it can schedule
+// follow-ups as well.
+// Returns ErrNilTask if no task is provided, or ErrNotInTask unless ctx is the context given to a task of the
+// handler executed by the handler loop, the read and offloaded tasks excluded, and this task has not returned yet.
+func (h *ThreadSafeActionHandler) ScheduleAfter(ctx context.Context, task ThreadSafeTaskCtx, args interface{}) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	scheduler, _ := ctx.Value(taskKey{handler: h}).(*ctrlAction)
+	if scheduler == nil {
+		return ErrNotInTask
+	}
+	followUp := h.newAsyncAction(nil, args)
+	followUp.ctrlThreadSafeCtx.controlFunc = task
+	scheduler.followUpMutex.Lock()
+	defer scheduler.followUpMutex.Unlock()
+	// The task context may have escaped the task, to a goroutine for instance, which may outlive it
+	if scheduler.followUpsClosed {
+		return ErrNotInTask
+	}
+	// The running task is still in flight: a shutdown waits for the follow-up as well
+	h.inflight.Add(1)
+	atomic.AddInt64(&h.pending, 1)
+	atomic.AddInt64(&h.queued, 1)
+	scheduler.followUps = append(scheduler.followUps, followUp)
+	return nil
+}
+
+// closeFollowUps returns the follow-ups scheduled by the exclusive task once it has returned, and rejects the next
+// ones: only the handler loop may then access them
+func (c *ctrlAction) closeFollowUps() []*ctrlAction {
+	c.followUpMutex.Lock()
+	defer c.followUpMutex.Unlock()
+	c.followUpsClosed = true
+	followUps := c.followUps
+	c.followUps = nil
+	return followUps
+}
+
+// runDeferred executes the follow-ups scheduled by the task the handler loop has just dispatched, in order,
+// including the ones scheduled by the follow-ups themselves, appended to deferred once each follow-up has returned
+func (h *ThreadSafeActionHandler) runDeferred() {
+	for len(h.deferred) > 0 {
+		ctrl := h.deferred[0]
+		h.deferred[0] = nil
+		h.deferred = h.deferred[1:]
+		h.dequeue(ctrl)
+		h.dispatch(ctrl)
+	}
+}
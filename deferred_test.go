@@ -0,0 +1,116 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// recordTaskCtx returns a context-aware task appending args to executed
+func recordTaskCtx(executed *[]interface{}) action.ThreadSafeTaskCtx {
+	return func(_ context.Context, args interface{}) (interface{}, error) {
+		*executed = append(*executed, args)
+		return nil, nil
+	}
+}
+
+func Test_ShouldExecuteTheFollowUpsRightAfterTheTaskSchedulingThem(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(4))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	record := recordTaskCtx(&executed)
+	scheduled := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, args interface{}) (interface{}, error) {
+			executed = append(executed, "task")
+			if err := actionHandler.ScheduleAfter(ctx, func(ctx context.Context, args interface{}) (interface{}, error) {
+				executed = append(executed, args)
+				// A follow-up may schedule follow-ups as well
+				return nil, actionHandler.ScheduleAfter(ctx, record, "follow-up of follow-up")
+			}, "follow-up 1"); err != nil {
+				return nil, err
+			}
+			return nil, actionHandler.ScheduleAfter(ctx, record, "follow-up 2")
+		}, nil)
+		scheduled <- err
+	}()
+	for actionHandler.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	actionHandler.AsynchronousActionSend(recordTask(&executed), "next task")
+	release()
+
+	assert.NilError(t, <-scheduled)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{"task", "follow-up 1", "follow-up 2", "follow-up of follow-up", "next task"})
+}
+
+func Test_ShouldOnlyScheduleFollowUpsFromATaskOfTheHandler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	otherHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	noop := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	assert.Assert(t, errors.Is(actionHandler.ScheduleAfter(context.TODO(), noop, nil), action.ErrNotInTask))
+	_, err := otherHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return nil, actionHandler.ScheduleAfter(ctx, noop, nil)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrNotInTask))
+	_, err = actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return nil, actionHandler.ScheduleAfter(ctx, nil, nil)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrNilTask))
+}
+
+func Test_ShouldWaitForTheFollowUpsOnClose(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	var executed []interface{}
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return nil, actionHandler.ScheduleAfter(ctx, recordTaskCtx(&executed), "follow-up")
+	}, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, actionHandler.Close())
+	assert.DeepEqual(t, executed, []interface{}{"follow-up"})
+}
+
+func Test_ShouldRejectTheFollowUpsScheduledOnceTheTaskHasReturned(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	var executed []interface{}
+	record := recordTaskCtx(&executed)
+
+	escaped := make(chan context.Context, 1)
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		escaped <- ctx
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+	scheduled := make(chan error)
+	go func() {
+		scheduled <- actionHandler.ScheduleAfter(<-escaped, record, "escaped")
+	}()
+	// The handler loop keeps scheduling follow-ups meanwhile
+	for i := 0; i < 10; i++ {
+		_, err = actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return nil, actionHandler.ScheduleAfter(ctx, record, "follow-up")
+		}, nil)
+		assert.NilError(t, err)
+	}
+
+	assert.Assert(t, errors.Is(<-scheduled, action.ErrNotInTask))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, len(executed), 10)
+	assert.Equal(t, actionHandler.Len(), 0)
+}
@@ -0,0 +1,51 @@
+package action
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of its parent context but is never done
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// NewThreadSafeActionHandlerWithDrain creates a new ThreadSafeActionHandler shut down gracefully once ctx is done:
+// instead of abandoning the queued tasks, the handler rejects new tasks and executes the ones already submitted
+// before its loop exits. Use Wait to block until the drain completes. A nil ctx defaults to context.Background().
+func NewThreadSafeActionHandlerWithDrain(ctx context.Context, opts ...Option) *ThreadSafeActionHandler {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	handler := NewThreadSafeActionHandler(detachedContext{parent: ctx}, opts...)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = handler.Close()
+		case <-handler.Done():
+		}
+	}()
+	return handler
+}
+
+// Wait blocks until the handler loop has exited, once the drain has completed for a handler created with
+// NewThreadSafeActionHandlerWithDrain. See Done.
+func (h *ThreadSafeActionHandler) Wait() {
+	<-h.Done()
+}
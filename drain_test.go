@@ -0,0 +1,65 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldDrainTheQueuedTasksOnceTheContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandlerWithDrain(handlerCtx, action.WithQueueSize(10))
+	release := blockHandler(actionHandler)
+
+	executed := 0
+	for i := 0; i < 10; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	cancelHandler()
+	release()
+	actionHandler.Wait()
+
+	assert.Equal(t, executed, 10)
+	_, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+}
+
+func Test_ShouldWaitForAClosedDrainedHandler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandlerWithDrain(handlerCtx)
+
+	result, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, 42)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 42)
+
+	assert.NilError(t, actionHandler.Close())
+	actionHandler.Wait()
+	assert.Assert(t, !actionHandler.Healthy())
+}
+
+func Test_ShouldDrainAHandlerCreatedWithANilContextOnceClosed(t *testing.T) {
+	// A nil context is handled on purpose
+	actionHandler := action.NewThreadSafeActionHandlerWithDrain(nil)
+
+	executed := false
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}, nil)
+	assert.NilError(t, actionHandler.Close())
+	actionHandler.Wait()
+	assert.Assert(t, executed)
+}
@@ -0,0 +1,59 @@
+package action
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// GoWithGroup executes the task with the handler as a member of the errgroup: the task is sent synchronously from
+// a goroutine started by g.Go and its error, or the send error, is returned to the group.
+// With a group created by errgroup.WithContext, the first error cancels the group context.
+func GoWithGroup(g *errgroup.Group, h *ThreadSafeActionHandler, threadSafeTask ThreadSafeTask, args interface{}) {
+	g.Go(func() error {
+		_, err := h.SynchronousActionSend(threadSafeTask, args)
+		return err
+	})
+}
+
+// SendAllAndWait sends the tasks asynchronously, tasks[i] with args[i], and waits for all of them to be executed
+// or discarded. args may be nil to execute every task with nil args.
+// Returns the first error in submission order, nil if every task succeeded. Nothing is sent when a task is nil,
+// ErrNilTask being returned, or when args and tasks lengths differ. It must not be called from a task of the same
+// handler, which would deadlock.
+func (h *ThreadSafeActionHandler) SendAllAndWait(tasks []ThreadSafeTask, args []interface{}) error {
+	if args != nil && len(args) != len(tasks) {
+		return fmt.Errorf("thread-safe action handler: %d tasks sent with %d args", len(tasks), len(args))
+	}
+	for _, task := range tasks {
+		if task == nil {
+			return ErrNilTask
+		}
+	}
+	errs := make([]error, len(tasks))
+	var done sync.WaitGroup
+	for i, task := range tasks {
+		var taskArgs interface{}
+		if args != nil {
+			taskArgs = args[i]
+		}
+		i := i
+		action := h.newAsyncAction(task, taskArgs)
+		action.onDone = func(reply taskReply, _ bool) {
+			errs[i] = reply.err
+			done.Done()
+		}
+		done.Add(1)
+		if err := h.sendAsyncAction(action); err != nil {
+			action.onDone(taskReply{err: err}, false)
+		}
+	}
+	done.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
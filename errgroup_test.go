@@ -0,0 +1,88 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldReturnTheFirstTaskErrorToTheGroup(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	taskErr := errors.New("task error")
+
+	group, groupCtx := errgroup.WithContext(context.TODO())
+	executed := 0
+	for i := 0; i < 10; i++ {
+		action.GoWithGroup(group, actionHandler, func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	action.GoWithGroup(group, actionHandler, func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, nil)
+
+	assert.Assert(t, errors.Is(group.Wait(), taskErr))
+	assert.Equal(t, groupCtx.Err(), context.Canceled)
+	assert.Equal(t, executed, 10)
+}
+
+func Test_ShouldReturnTheSendErrorToTheGroup(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	assert.NilError(t, actionHandler.Close())
+
+	var group errgroup.Group
+	action.GoWithGroup(&group, actionHandler, func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, errors.Is(group.Wait(), action.ErrHandlerClosed))
+}
+
+func Test_ShouldSendAllTheTasksAndReturnTheFirstError(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	firstErr := errors.New("first error")
+	secondErr := errors.New("second error")
+
+	var executed []interface{}
+	taskErrs := map[interface{}]error{2: firstErr, 4: secondErr}
+	failingTask := func(args interface{}) (interface{}, error) {
+		executed = append(executed, args)
+		return nil, taskErrs[args]
+	}
+	err := actionHandler.SendAllAndWait(
+		[]action.ThreadSafeTask{recordTask(&executed), failingTask, recordTask(&executed), failingTask},
+		[]interface{}{1, 2, 3, 4})
+	assert.Assert(t, errors.Is(err, firstErr))
+	// Every task is executed whatever the errors
+	assert.DeepEqual(t, executed, []interface{}{1, 2, 3, 4})
+
+	assert.NilError(t, actionHandler.SendAllAndWait([]action.ThreadSafeTask{recordTask(&executed), recordTask(&executed)}, nil))
+	assert.Equal(t, len(executed), 6)
+}
+
+func Test_ShouldNotSendAnyTaskWhenTheTasksAreInvalid(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	var executed []interface{}
+	err := actionHandler.SendAllAndWait([]action.ThreadSafeTask{recordTask(&executed), nil}, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+	err = actionHandler.SendAllAndWait([]action.ThreadSafeTask{recordTask(&executed)}, []interface{}{1, 2})
+	assert.ErrorContains(t, err, "1 tasks sent with 2 args")
+	assert.NilError(t, actionHandler.Flush(context.TODO()))
+	assert.Equal(t, len(executed), 0)
+
+	assert.NilError(t, actionHandler.Close())
+	err = actionHandler.SendAllAndWait([]action.ThreadSafeTask{recordTask(&executed)}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerClosed))
+}
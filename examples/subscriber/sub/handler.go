@@ -2,19 +2,27 @@ package sub
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/lithammer/shortuuid/v3"
 
 	action "github.com/sbracaloni/thread-safe-action"
 )
 
+// ErrSubscriptionNotFound is returned when a subscription does not exist for the given theme
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
 // SubscriptionHandler interface
 type SubscriptionHandler interface {
 	AddNewSubscription(theme ActivityTheme, name PersonName) (SubscriptionID, error)
 	CountSubscriptionByTheme(theme ActivityTheme) (int, error)
+	SubscriptionExists(theme ActivityTheme, subID SubscriptionID) (bool, error)
+	GetSubscriber(theme ActivityTheme, subID SubscriptionID) (PersonName, error)
 	RemoveSubscriptionSync(theme ActivityTheme, subID SubscriptionID) error
 	RemoveSubscriptionAsync(theme ActivityTheme, subID SubscriptionID)
+	RemovePersonEverywhere(name PersonName) (int, error)
 }
 
 // ActivityTheme represents a specific theme
@@ -31,17 +39,43 @@ type SubscriptionHandlerLockFree struct {
 	subsByTheme             map[ActivityTheme]map[SubscriptionID]PersonName
 	ctx                     context.Context
 	threadSafeActionHandler *action.ThreadSafeActionHandler
+	idGen                   func() SubscriptionID
+	// watchers are the theme count watchers, see WatchThemeCount
+	watchers map[ActivityTheme][]*themeWatcher
+	// counters are the theme counters, independent from the subscriptions, see AdjustThemeCounter
+	counters map[ActivityTheme]int
 }
 
 // NewSubscriptionHandlerLockFree initializes a new SubscriptionHandlerLockFree
 func NewSubscriptionHandlerLockFree(ctx context.Context, handler *action.ThreadSafeActionHandler) *SubscriptionHandlerLockFree {
+	return NewSubscriptionHandlerLockFreeWithIDGen(ctx, handler, newShortUUID)
+}
+
+// NewSubscriptionHandlerLockFreeWithIDGen initializes a new SubscriptionHandlerLockFree generating the subscription
+// IDs with idGen. idGen is only called from the thread safe context, it does not need to be thread safe itself.
+func NewSubscriptionHandlerLockFreeWithIDGen(ctx context.Context, handler *action.ThreadSafeActionHandler, idGen func() SubscriptionID) *SubscriptionHandlerLockFree {
 	return &SubscriptionHandlerLockFree{
 		subsByTheme:             map[ActivityTheme]map[SubscriptionID]PersonName{},
 		ctx:                     ctx,
 		threadSafeActionHandler: handler,
+		idGen:                   idGen,
+		watchers:                map[ActivityTheme][]*themeWatcher{},
+		counters:                map[ActivityTheme]int{},
+	}
+}
+
+// ignoreCtx adapts a thread safe task to the context-aware sends, the task not using the call context
+func ignoreCtx(task action.ThreadSafeTask) action.ThreadSafeTaskCtx {
+	return func(_ context.Context, args interface{}) (interface{}, error) {
+		return task(args)
 	}
 }
 
+// newShortUUID is the default subscription ID generator
+func newShortUUID() SubscriptionID {
+	return SubscriptionID(shortuuid.New())
+}
+
 type newSubscriptionArgs struct {
 	theme ActivityTheme
 	name  PersonName
@@ -54,15 +88,22 @@ func (s *SubscriptionHandlerLockFree) addNewSubscriptionThreadSafe(args interfac
 		subByID = map[SubscriptionID]PersonName{}
 		s.subsByTheme[newSubArgs.theme] = subByID
 	}
-	subID := SubscriptionID(shortuuid.New())
+	subID := s.idGen()
 	subByID[subID] = newSubArgs.name
+	s.notifyThemeWatchers(newSubArgs.theme)
 	return subID, nil
 }
 
 // AddNewSubscription creates a new subscription to a theme for the given user name
 func (s *SubscriptionHandlerLockFree) AddNewSubscription(theme ActivityTheme, name PersonName) (SubscriptionID, error) {
+	return s.AddNewSubscriptionCtx(context.Background(), theme, name)
+}
+
+// AddNewSubscriptionCtx creates a new subscription to a theme for the given user name, giving up once ctx is done:
+// it returns ctx error, and the subscription is not created unless its creation had already started
+func (s *SubscriptionHandlerLockFree) AddNewSubscriptionCtx(ctx context.Context, theme ActivityTheme, name PersonName) (SubscriptionID, error) {
 	// Update the map in a thread safe environment
-	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.addNewSubscriptionThreadSafe, newSubscriptionArgs{
+	reply, err := s.threadSafeActionHandler.SynchronousActionSendCtx(ctx, ignoreCtx(s.addNewSubscriptionThreadSafe), newSubscriptionArgs{
 		theme: theme,
 		name:  name,
 	})
@@ -75,6 +116,120 @@ func (s *SubscriptionHandlerLockFree) AddNewSubscription(theme ActivityTheme, na
 	return subID, nil
 }
 
+type newSubscriptionsBulkArgs struct {
+	theme ActivityTheme
+	names []PersonName
+}
+
+func (s *SubscriptionHandlerLockFree) addNewSubscriptionsBulkThreadSafe(args interface{}) (interface{}, error) {
+	bulkArgs := args.(newSubscriptionsBulkArgs)
+	subByID, exists := s.subsByTheme[bulkArgs.theme]
+	if !exists {
+		subByID = make(map[SubscriptionID]PersonName, len(bulkArgs.names))
+		s.subsByTheme[bulkArgs.theme] = subByID
+	}
+	subIDs := make([]SubscriptionID, len(bulkArgs.names))
+	for i, name := range bulkArgs.names {
+		subIDs[i] = s.idGen()
+		subByID[subIDs[i]] = name
+	}
+	if len(subByID) == 0 {
+		delete(s.subsByTheme, bulkArgs.theme)
+	}
+	// The watchers are notified once, with the final count
+	s.notifyThemeWatchers(bulkArgs.theme)
+	return subIDs, nil
+}
+
+// AddNewSubscriptionsBulk creates a new subscription to a theme for each of the given user names, all in a single
+// thread safe task. Returns the IDs of the subscriptions in the order of the names
+func (s *SubscriptionHandlerLockFree) AddNewSubscriptionsBulk(theme ActivityTheme, names []PersonName) ([]SubscriptionID, error) {
+	// Update the map in a thread safe environment, all the creations in one task
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.addNewSubscriptionsBulkThreadSafe, newSubscriptionsBulkArgs{
+		theme: theme,
+		names: names,
+	})
+	if err != nil {
+		return nil, err
+	}
+	subIDs := reply.([]SubscriptionID)
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: %d new subs => %s\n", len(subIDs), theme)
+	return subIDs, nil
+}
+
+// Subscription is the full record of a subscription
+type Subscription struct {
+	ID        SubscriptionID
+	Theme     ActivityTheme
+	Name      PersonName
+	CreatedAt time.Time
+}
+
+func (s *SubscriptionHandlerLockFree) subscribeDetailedThreadSafe(args interface{}) (interface{}, error) {
+	newSubArgs := args.(newSubscriptionArgs)
+	subID, err := s.addNewSubscriptionThreadSafe(newSubArgs)
+	if err != nil {
+		return nil, err
+	}
+	// The creation time is taken in the thread safe context: sequential creations get ordered timestamps
+	return Subscription{
+		ID:        subID.(SubscriptionID),
+		Theme:     newSubArgs.theme,
+		Name:      newSubArgs.name,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// SubscribeDetailed creates a new subscription to a theme for the given user name and returns the full
+// subscription record
+func (s *SubscriptionHandlerLockFree) SubscribeDetailed(theme ActivityTheme, name PersonName) (Subscription, error) {
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.subscribeDetailedThreadSafe, newSubscriptionArgs{
+		theme: theme,
+		name:  name,
+	})
+	if err != nil {
+		return Subscription{}, err
+	}
+	return reply.(Subscription), nil
+}
+
+type newSubscriptionUnderLimitArgs struct {
+	newSubscriptionArgs
+	limit int
+}
+
+func (s *SubscriptionHandlerLockFree) addSubscriptionIfUnderLimitThreadSafe(args interface{}) (interface{}, error) {
+	newSubArgs := args.(newSubscriptionUnderLimitArgs)
+	// The count check and the creation happen in the same thread safe task: no other subscription can be added
+	// in between
+	if len(s.subsByTheme[newSubArgs.theme]) >= newSubArgs.limit {
+		return nil, nil
+	}
+	return s.addNewSubscriptionThreadSafe(newSubArgs.newSubscriptionArgs)
+}
+
+// AddSubscriptionIfUnderLimit creates a new subscription to a theme for the given user name, only if the theme
+// has less than limit subscriptions.
+// Returns false if the theme is already at capacity
+func (s *SubscriptionHandlerLockFree) AddSubscriptionIfUnderLimit(theme ActivityTheme, name PersonName, limit int) (SubscriptionID, bool, error) {
+	// Check and update the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.addSubscriptionIfUnderLimitThreadSafe, newSubscriptionUnderLimitArgs{
+		newSubscriptionArgs: newSubscriptionArgs{
+			theme: theme,
+			name:  name,
+		},
+		limit: limit,
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if reply == nil {
+		return "", false, nil
+	}
+	return reply.(SubscriptionID), true, nil
+}
+
 type countSubscriptionArgs struct {
 	theme ActivityTheme
 }
@@ -88,10 +243,18 @@ func (s *SubscriptionHandlerLockFree) countSubscriptionByThemeThreadSafe(args in
 	return len(subByID), nil
 }
 
-// CountSubscriptionByTheme returns the number of subscriptions by theme
+// CountSubscriptionByTheme returns the number of subscriptions by theme.
+// The count is a read task: it runs concurrently with the other read tasks but never with a write, so it never
+// observes the subscriptions in the middle of an update, however heavy the writes.
 func (s *SubscriptionHandlerLockFree) CountSubscriptionByTheme(theme ActivityTheme) (int, error) {
-	// Update the map in a thread safe environment
-	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.countSubscriptionByThemeThreadSafe, countSubscriptionArgs{
+	return s.CountSubscriptionByThemeCtx(context.Background(), theme)
+}
+
+// CountSubscriptionByThemeCtx returns the number of subscriptions by theme, giving up once ctx is done. See
+// CountSubscriptionByTheme.
+func (s *SubscriptionHandlerLockFree) CountSubscriptionByThemeCtx(ctx context.Context, theme ActivityTheme) (int, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousReadActionSendCtx(ctx, ignoreCtx(s.countSubscriptionByThemeThreadSafe), countSubscriptionArgs{
 		theme: theme,
 	})
 	if err != nil {
@@ -102,6 +265,177 @@ func (s *SubscriptionHandlerLockFree) CountSubscriptionByTheme(theme ActivityThe
 	return subCount, nil
 }
 
+func (s *SubscriptionHandlerLockFree) countAllSubscriptionsThreadSafe(interface{}) (interface{}, error) {
+	total := 0
+	for _, subByID := range s.subsByTheme {
+		total += len(subByID)
+	}
+	return total, nil
+}
+
+// CountAllSubscriptions returns the number of subscriptions of all the themes. The themes are counted in the same
+// thread safe task: unlike summing CountSubscriptionByTheme calls, the total reflects a single moment
+func (s *SubscriptionHandlerLockFree) CountAllSubscriptions() (int, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.countAllSubscriptionsThreadSafe, nil)
+	if err != nil {
+		return -1, err
+	}
+	return reply.(int), nil
+}
+
+func (s *SubscriptionHandlerLockFree) countByAllThemesThreadSafe(interface{}) (interface{}, error) {
+	countByTheme := make(map[ActivityTheme]int, len(s.subsByTheme))
+	for theme, subByID := range s.subsByTheme {
+		if len(subByID) > 0 {
+			countByTheme[theme] = len(subByID)
+		}
+	}
+	return countByTheme, nil
+}
+
+// CountByAllThemes returns the number of subscriptions of each theme having subscriptions. The themes are counted in
+// the same thread safe task: the counts reflect a single moment
+func (s *SubscriptionHandlerLockFree) CountByAllThemes() (map[ActivityTheme]int, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.countByAllThemesThreadSafe, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply.(map[ActivityTheme]int), nil
+}
+
+type adjustThemeCounterArgs struct {
+	theme ActivityTheme
+	delta int
+}
+
+func (s *SubscriptionHandlerLockFree) adjustThemeCounterThreadSafe(args interface{}) (interface{}, error) {
+	adjustArgs := args.(adjustThemeCounterArgs)
+	// The read and the write happen in the same thread safe task: no concurrent adjustment can be lost
+	newValue := s.counters[adjustArgs.theme] + adjustArgs.delta
+	if newValue == 0 {
+		delete(s.counters, adjustArgs.theme)
+	} else {
+		s.counters[adjustArgs.theme] = newValue
+	}
+	return newValue, nil
+}
+
+// AdjustThemeCounter adds delta, which may be negative, to the counter of the theme and returns its new value.
+// The theme counters are independent from the subscriptions and start at 0
+func (s *SubscriptionHandlerLockFree) AdjustThemeCounter(theme ActivityTheme, delta int) (int, error) {
+	// Update the counters in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.adjustThemeCounterThreadSafe, adjustThemeCounterArgs{
+		theme: theme,
+		delta: delta,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int), nil
+}
+
+type getSubscriptionArgs struct {
+	subID SubscriptionID
+	theme ActivityTheme
+}
+
+func (s *SubscriptionHandlerLockFree) getSubscriberThreadSafe(args interface{}) (interface{}, error) {
+	getSubArgs := args.(getSubscriptionArgs)
+	name, exists := s.subsByTheme[getSubArgs.theme][getSubArgs.subID]
+	if !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+	return name, nil
+}
+
+// SubscriptionExists checks whether the subID subscription exists for the given theme
+func (s *SubscriptionHandlerLockFree) SubscriptionExists(theme ActivityTheme, subID SubscriptionID) (bool, error) {
+	return s.SubscriptionExistsCtx(context.Background(), theme, subID)
+}
+
+// SubscriptionExistsCtx checks whether the subID subscription exists for the given theme, giving up once ctx is done
+func (s *SubscriptionHandlerLockFree) SubscriptionExistsCtx(ctx context.Context, theme ActivityTheme, subID SubscriptionID) (bool, error) {
+	// Read the map in a thread safe environment
+	_, err := s.threadSafeActionHandler.SynchronousActionSendCtx(ctx, ignoreCtx(s.getSubscriberThreadSafe), getSubscriptionArgs{
+		theme: theme,
+		subID: subID,
+	})
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetSubscriber returns the name of the person who subscribed to the theme with the subID subscription.
+// Returns ErrSubscriptionNotFound if there is no such subscription
+func (s *SubscriptionHandlerLockFree) GetSubscriber(theme ActivityTheme, subID SubscriptionID) (PersonName, error) {
+	return s.GetSubscriberCtx(context.Background(), theme, subID)
+}
+
+// GetSubscriberCtx returns the name of the person who subscribed to the theme with the subID subscription, giving up
+// once ctx is done. Returns ErrSubscriptionNotFound if there is no such subscription
+func (s *SubscriptionHandlerLockFree) GetSubscriberCtx(ctx context.Context, theme ActivityTheme, subID SubscriptionID) (PersonName, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSendCtx(ctx, ignoreCtx(s.getSubscriberThreadSafe), getSubscriptionArgs{
+		theme: theme,
+		subID: subID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return reply.(PersonName), nil
+}
+
+func (s *SubscriptionHandlerLockFree) listThemesThreadSafe(interface{}) (interface{}, error) {
+	themes := make([]ActivityTheme, 0, len(s.subsByTheme))
+	for theme := range s.subsByTheme {
+		themes = append(themes, theme)
+	}
+	return themes, nil
+}
+
+// ListThemes returns the themes having at least one subscription, in no particular order
+func (s *SubscriptionHandlerLockFree) ListThemes() ([]ActivityTheme, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.listThemesThreadSafe, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply.([]ActivityTheme), nil
+}
+
+type listSubscriptionsArgs struct {
+	theme ActivityTheme
+}
+
+func (s *SubscriptionHandlerLockFree) listSubscriptionsByThemeThreadSafe(args interface{}) (interface{}, error) {
+	listSubArgs := args.(listSubscriptionsArgs)
+	// Copy the map: the caller must not access the internal one outside of the thread safe context
+	subByID := s.subsByTheme[listSubArgs.theme]
+	subs := make(map[SubscriptionID]PersonName, len(subByID))
+	for subID, name := range subByID {
+		subs[subID] = name
+	}
+	return subs, nil
+}
+
+// ListSubscriptionsByTheme returns a copy of the subscriptions of the given theme
+func (s *SubscriptionHandlerLockFree) ListSubscriptionsByTheme(theme ActivityTheme) (map[SubscriptionID]PersonName, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.listSubscriptionsByThemeThreadSafe, listSubscriptionsArgs{
+		theme: theme,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(map[SubscriptionID]PersonName), nil
+}
+
 type removeSubscriptionArgs struct {
 	subID SubscriptionID
 	theme ActivityTheme
@@ -109,20 +443,28 @@ type removeSubscriptionArgs struct {
 
 func (s *SubscriptionHandlerLockFree) removeSubscriptionThreadSafe(args interface{}) (interface{}, error) {
 	removeSubArgs := args.(removeSubscriptionArgs)
-	subByID, exists := s.subsByTheme[removeSubArgs.theme]
-	if exists {
-		delete(subByID, removeSubArgs.subID)
-		if len(subByID) == 0 {
-			delete(s.subsByTheme, removeSubArgs.theme)
-		}
+	subByID := s.subsByTheme[removeSubArgs.theme]
+	if _, exists := subByID[removeSubArgs.subID]; !exists {
+		return false, nil
 	}
-	return nil, nil
+	delete(subByID, removeSubArgs.subID)
+	if len(subByID) == 0 {
+		delete(s.subsByTheme, removeSubArgs.theme)
+	}
+	s.notifyThemeWatchers(removeSubArgs.theme)
+	return true, nil
 }
 
 // RemoveSubscriptionSync deletes a the subscription associated to the subID for the given theme
 func (s *SubscriptionHandlerLockFree) RemoveSubscriptionSync(theme ActivityTheme, subID SubscriptionID) error {
+	return s.RemoveSubscriptionSyncCtx(context.Background(), theme, subID)
+}
+
+// RemoveSubscriptionSyncCtx deletes the subscription associated to the subID for the given theme, giving up once ctx
+// is done: it returns ctx error, and the subscription is not deleted unless its deletion had already started
+func (s *SubscriptionHandlerLockFree) RemoveSubscriptionSyncCtx(ctx context.Context, theme ActivityTheme, subID SubscriptionID) error {
 	// Update the map in a thread safe environment
-	_, err := s.threadSafeActionHandler.SynchronousActionSend(s.removeSubscriptionThreadSafe, removeSubscriptionArgs{
+	_, err := s.threadSafeActionHandler.SynchronousActionSendCtx(ctx, ignoreCtx(s.removeSubscriptionThreadSafe), removeSubscriptionArgs{
 		theme: theme,
 		subID: subID,
 	})
@@ -134,6 +476,25 @@ func (s *SubscriptionHandlerLockFree) RemoveSubscriptionSync(theme ActivityTheme
 	return nil
 }
 
+// RemoveSubscriptionSyncExists deletes the subscription associated to the subID for the given theme.
+// Returns false if there was no such subscription to delete
+func (s *SubscriptionHandlerLockFree) RemoveSubscriptionSyncExists(theme ActivityTheme, subID SubscriptionID) (bool, error) {
+	// Update the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.removeSubscriptionThreadSafe, removeSubscriptionArgs{
+		theme: theme,
+		subID: subID,
+	})
+	if err != nil {
+		return false, err
+	}
+	removed := reply.(bool)
+	// do something with no thread safe constraint
+	if removed {
+		fmt.Printf("[Not thread safe action]:: removed sub %s-%s\n", subID, theme)
+	}
+	return removed, nil
+}
+
 // RemoveSubscriptionAsync sends a delete order to remove a the subscription associated to the subID for the given theme
 func (s *SubscriptionHandlerLockFree) RemoveSubscriptionAsync(theme ActivityTheme, subID SubscriptionID) {
 	// Update the map in a thread safe environment
@@ -145,3 +506,366 @@ func (s *SubscriptionHandlerLockFree) RemoveSubscriptionAsync(theme ActivityThem
 	// do something with no thread safe constraint
 	fmt.Printf("[Not thread safe action]:: asked for sub %s-%s remove\n", subID, theme)
 }
+
+type removePersonEverywhereArgs struct {
+	name PersonName
+}
+
+func (s *SubscriptionHandlerLockFree) removePersonEverywhereThreadSafe(args interface{}) (interface{}, error) {
+	removePersonArgs := args.(removePersonEverywhereArgs)
+	nbRemoved := 0
+	for theme, subByID := range s.subsByTheme {
+		removedFromTheme := false
+		for subID, name := range subByID {
+			if name == removePersonArgs.name {
+				delete(subByID, subID)
+				nbRemoved++
+				removedFromTheme = true
+			}
+		}
+		if len(subByID) == 0 {
+			delete(s.subsByTheme, theme)
+		}
+		if removedFromTheme {
+			s.notifyThemeWatchers(theme)
+		}
+	}
+	return nbRemoved, nil
+}
+
+// RemovePersonEverywhere deletes all the subscriptions of the person with the given name, whatever their theme, in
+// a single thread safe task. Returns the number of removed subscriptions
+func (s *SubscriptionHandlerLockFree) RemovePersonEverywhere(name PersonName) (int, error) {
+	// Update the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.removePersonEverywhereThreadSafe, removePersonEverywhereArgs{
+		name: name,
+	})
+	if err != nil {
+		return 0, err
+	}
+	nbRemoved := reply.(int)
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: removed %d subs of %s\n", nbRemoved, name)
+	return nbRemoved, nil
+}
+
+// SubscriptionRef identifies a subscription of a theme
+type SubscriptionRef struct {
+	Theme ActivityTheme
+	SubID SubscriptionID
+}
+
+type removeSubscriptionsBatchArgs struct {
+	items []SubscriptionRef
+}
+
+func (s *SubscriptionHandlerLockFree) removeSubscriptionsBatchThreadSafe(args interface{}) (interface{}, error) {
+	removeBatchArgs := args.(removeSubscriptionsBatchArgs)
+	for _, item := range removeBatchArgs.items {
+		_, _ = s.removeSubscriptionThreadSafe(removeSubscriptionArgs{
+			theme: item.Theme,
+			subID: item.SubID,
+		})
+	}
+	return nil, nil
+}
+
+// RemoveSubscriptionsBatchAsync sends a single delete order removing all the given subscriptions
+func (s *SubscriptionHandlerLockFree) RemoveSubscriptionsBatchAsync(items []SubscriptionRef) {
+	// Update the map in a thread safe environment, all the deletions in one task
+	s.threadSafeActionHandler.AsynchronousActionSend(s.removeSubscriptionsBatchThreadSafe, removeSubscriptionsBatchArgs{
+		items: items,
+	})
+
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: asked for %d subs remove\n", len(items))
+}
+
+type removeAllSubscriptionsArgs struct {
+	theme ActivityTheme
+}
+
+func (s *SubscriptionHandlerLockFree) removeAllSubscriptionsForThemeThreadSafe(args interface{}) (interface{}, error) {
+	removeAllArgs := args.(removeAllSubscriptionsArgs)
+	nbRemoved := len(s.subsByTheme[removeAllArgs.theme])
+	delete(s.subsByTheme, removeAllArgs.theme)
+	s.notifyThemeWatchers(removeAllArgs.theme)
+	return nbRemoved, nil
+}
+
+// RemoveAllSubscriptionsForTheme deletes all the subscriptions of the given theme at once.
+// Returns the number of removed subscriptions
+func (s *SubscriptionHandlerLockFree) RemoveAllSubscriptionsForTheme(theme ActivityTheme) (int, error) {
+	// Update the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.removeAllSubscriptionsForThemeThreadSafe, removeAllSubscriptionsArgs{
+		theme: theme,
+	})
+	if err != nil {
+		return 0, err
+	}
+	nbRemoved := reply.(int)
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: removed %d subs from %s\n", nbRemoved, theme)
+	return nbRemoved, nil
+}
+
+type moveSubscriptionArgs struct {
+	subID     SubscriptionID
+	fromTheme ActivityTheme
+	toTheme   ActivityTheme
+}
+
+func (s *SubscriptionHandlerLockFree) moveSubscriptionThreadSafe(args interface{}) (interface{}, error) {
+	moveSubArgs := args.(moveSubscriptionArgs)
+	name, exists := s.subsByTheme[moveSubArgs.fromTheme][moveSubArgs.subID]
+	if !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+	// Both mutations happen in the same thread safe task: the subscription is never observed in both themes or
+	// in none of them
+	_, _ = s.removeSubscriptionThreadSafe(removeSubscriptionArgs{
+		theme: moveSubArgs.fromTheme,
+		subID: moveSubArgs.subID,
+	})
+	subByID, exists := s.subsByTheme[moveSubArgs.toTheme]
+	if !exists {
+		subByID = map[SubscriptionID]PersonName{}
+		s.subsByTheme[moveSubArgs.toTheme] = subByID
+	}
+	subByID[moveSubArgs.subID] = name
+	s.notifyThemeWatchers(moveSubArgs.toTheme)
+	return nil, nil
+}
+
+// MoveSubscription transfers the subID subscription from a theme to another one atomically.
+// Returns ErrSubscriptionNotFound if fromTheme has no such subscription
+func (s *SubscriptionHandlerLockFree) MoveSubscription(fromTheme, toTheme ActivityTheme, subID SubscriptionID) error {
+	// Update the map in a thread safe environment
+	_, err := s.threadSafeActionHandler.SynchronousActionSend(s.moveSubscriptionThreadSafe, moveSubscriptionArgs{
+		subID:     subID,
+		fromTheme: fromTheme,
+		toTheme:   toTheme,
+	})
+	if err != nil {
+		return err
+	}
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: moved sub %s from %s to %s\n", subID, fromTheme, toTheme)
+	return nil
+}
+
+type updateSubscriberNameArgs struct {
+	subID   SubscriptionID
+	theme   ActivityTheme
+	newName PersonName
+}
+
+func (s *SubscriptionHandlerLockFree) updateSubscriberNameThreadSafe(args interface{}) (interface{}, error) {
+	updateArgs := args.(updateSubscriberNameArgs)
+	// The lookup and the update happen in the same thread safe task: the subscription cannot be removed in between
+	subByID := s.subsByTheme[updateArgs.theme]
+	if _, exists := subByID[updateArgs.subID]; !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+	subByID[updateArgs.subID] = updateArgs.newName
+	return nil, nil
+}
+
+// UpdateSubscriberName renames the person who subscribed to the theme with the subID subscription.
+// Returns ErrSubscriptionNotFound if there is no such subscription
+func (s *SubscriptionHandlerLockFree) UpdateSubscriberName(theme ActivityTheme, subID SubscriptionID, newName PersonName) error {
+	// Update the map in a thread safe environment
+	_, err := s.threadSafeActionHandler.SynchronousActionSend(s.updateSubscriberNameThreadSafe, updateSubscriberNameArgs{
+		subID:   subID,
+		theme:   theme,
+		newName: newName,
+	})
+	if err != nil {
+		return err
+	}
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: renamed sub %s of %s to %s\n", subID, theme, newName)
+	return nil
+}
+
+// copySubsByTheme returns a deep copy of subsByTheme, skipping the themes without subscription
+func copySubsByTheme(subsByTheme map[ActivityTheme]map[SubscriptionID]PersonName) map[ActivityTheme]map[SubscriptionID]PersonName {
+	state := make(map[ActivityTheme]map[SubscriptionID]PersonName, len(subsByTheme))
+	for theme, subByID := range subsByTheme {
+		if len(subByID) == 0 {
+			continue
+		}
+		subs := make(map[SubscriptionID]PersonName, len(subByID))
+		for subID, name := range subByID {
+			subs[subID] = name
+		}
+		state[theme] = subs
+	}
+	return state
+}
+
+func (s *SubscriptionHandlerLockFree) exportStateThreadSafe(interface{}) (interface{}, error) {
+	// Copy the maps: the caller must not access the internal ones outside of the thread safe context
+	return copySubsByTheme(s.subsByTheme), nil
+}
+
+// ExportState returns a copy of all the subscriptions by theme, taken at once
+func (s *SubscriptionHandlerLockFree) ExportState() (map[ActivityTheme]map[SubscriptionID]PersonName, error) {
+	// Read the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.exportStateThreadSafe, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply.(map[ActivityTheme]map[SubscriptionID]PersonName), nil
+}
+
+// snapshotThreadSafe is the snapshotter of the subscriptions: it copies them in the thread safe context
+func (s *SubscriptionHandlerLockFree) snapshotThreadSafe() interface{} {
+	return copySubsByTheme(s.subsByTheme)
+}
+
+// SnapshotFunc computes a value from a snapshot of the subscriptions by theme, see ComputeFromSnapshot
+type SnapshotFunc func(state map[ActivityTheme]map[SubscriptionID]PersonName) (interface{}, error)
+
+// ComputeFromSnapshot calls each fn with the same snapshot of all the subscriptions by theme, taken at once: the
+// values computed are consistent with each other. Returns the fn results in order, or the first fn error.
+// The fns are called in the thread safe context: they must be fast and must not call the
+// SubscriptionHandlerLockFree methods, which would return ErrReentrantSend. They may keep the snapshot, which is a copy.
+func (s *SubscriptionHandlerLockFree) ComputeFromSnapshot(fns ...SnapshotFunc) ([]interface{}, error) {
+	tasks := make([]action.SnapshotTask, len(fns))
+	for i, fn := range fns {
+		fn := fn
+		tasks[i] = func(snapshot interface{}) (interface{}, error) {
+			return fn(snapshot.(map[ActivityTheme]map[SubscriptionID]PersonName))
+		}
+	}
+	// Snapshot the map and compute the values in a thread safe environment
+	return s.threadSafeActionHandler.SynchronousActionSendWithSnapshot(s.snapshotThreadSafe, tasks...)
+}
+
+type importStateArgs struct {
+	state map[ActivityTheme]map[SubscriptionID]PersonName
+}
+
+func (s *SubscriptionHandlerLockFree) importStateThreadSafe(args interface{}) (interface{}, error) {
+	importArgs := args.(importStateArgs)
+	s.subsByTheme = importArgs.state
+	s.notifyAllWatchers()
+	return nil, nil
+}
+
+// ImportState replaces all the subscriptions at once with a copy of state
+func (s *SubscriptionHandlerLockFree) ImportState(state map[ActivityTheme]map[SubscriptionID]PersonName) error {
+	// The copy is done outside of the thread safe context: the caller keeps the ownership of state
+	_, err := s.threadSafeActionHandler.SynchronousActionSend(s.importStateThreadSafe, importStateArgs{
+		state: copySubsByTheme(state),
+	})
+	if err != nil {
+		return err
+	}
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: imported subs for %d themes\n", len(state))
+	return nil
+}
+
+func (s *SubscriptionHandlerLockFree) resetAllThreadSafe(interface{}) (interface{}, error) {
+	nbRemoved := 0
+	for _, subByID := range s.subsByTheme {
+		nbRemoved += len(subByID)
+	}
+	s.subsByTheme = map[ActivityTheme]map[SubscriptionID]PersonName{}
+	s.notifyAllWatchers()
+	return nbRemoved, nil
+}
+
+// ResetAll deletes all the subscriptions of all the themes at once
+func (s *SubscriptionHandlerLockFree) ResetAll() error {
+	// Replace the map in a thread safe environment
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.resetAllThreadSafe, nil)
+	if err != nil {
+		return err
+	}
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: reset, %d subs removed\n", reply.(int))
+	return nil
+}
+
+type replaceThemeSubscribersArgs struct {
+	theme ActivityTheme
+	subs  map[SubscriptionID]PersonName
+}
+
+type replaceThemeSubscribersResult struct {
+	added   int
+	removed int
+}
+
+func (s *SubscriptionHandlerLockFree) replaceThemeSubscribersThreadSafe(args interface{}) (interface{}, error) {
+	replaceArgs := args.(replaceThemeSubscribersArgs)
+	previous := s.subsByTheme[replaceArgs.theme]
+	result := replaceThemeSubscribersResult{}
+	for subID := range replaceArgs.subs {
+		if _, exists := previous[subID]; !exists {
+			result.added++
+		}
+	}
+	for subID := range previous {
+		if _, exists := replaceArgs.subs[subID]; !exists {
+			result.removed++
+		}
+	}
+	if len(replaceArgs.subs) == 0 {
+		delete(s.subsByTheme, replaceArgs.theme)
+	} else {
+		s.subsByTheme[replaceArgs.theme] = replaceArgs.subs
+	}
+	s.notifyThemeWatchers(replaceArgs.theme)
+	return result, nil
+}
+
+// ReplaceThemeSubscribers replaces all the subscriptions of the given theme at once with a copy of subs.
+// Returns the number of added and removed subscription IDs, the subscriptions kept being counted in neither
+func (s *SubscriptionHandlerLockFree) ReplaceThemeSubscribers(theme ActivityTheme, subs map[SubscriptionID]PersonName) (added, removed int, err error) {
+	// The copy is done outside of the thread safe context: the caller keeps the ownership of subs
+	subsCopy := make(map[SubscriptionID]PersonName, len(subs))
+	for subID, name := range subs {
+		subsCopy[subID] = name
+	}
+	reply, err := s.threadSafeActionHandler.SynchronousActionSend(s.replaceThemeSubscribersThreadSafe, replaceThemeSubscribersArgs{
+		theme: theme,
+		subs:  subsCopy,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	result := reply.(replaceThemeSubscribersResult)
+	// do something with no thread safe constraint
+	fmt.Printf("[Not thread safe action]:: replaced subs of %s: %d added, %d removed\n", theme, result.added, result.removed)
+	return result.added, result.removed, nil
+}
+
+type forEachSubscriptionArgs struct {
+	visit func(theme ActivityTheme, subID SubscriptionID, name PersonName)
+}
+
+func (s *SubscriptionHandlerLockFree) forEachSubscriptionThreadSafe(args interface{}) (interface{}, error) {
+	forEachArgs := args.(forEachSubscriptionArgs)
+	for theme, subByID := range s.subsByTheme {
+		for subID, name := range subByID {
+			forEachArgs.visit(theme, subID, name)
+		}
+	}
+	return nil, nil
+}
+
+// ForEachSubscription calls visit for each subscription, all the calls happening in the same thread safe task: the
+// visited subscriptions are a consistent snapshot. The visit order is not defined.
+// visit is called in the thread safe context: it must be fast, must not keep a reference to the state and must not
+// call the SubscriptionHandlerLockFree methods, which would return ErrReentrantSend.
+func (s *SubscriptionHandlerLockFree) ForEachSubscription(visit func(theme ActivityTheme, subID SubscriptionID, name PersonName)) error {
+	// Read the map in a thread safe environment
+	_, err := s.threadSafeActionHandler.SynchronousActionSend(s.forEachSubscriptionThreadSafe, forEachSubscriptionArgs{
+		visit: visit,
+	})
+	return err
+}
@@ -0,0 +1,81 @@
+package sub
+
+import (
+	"context"
+	"hash/fnv"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// SubscriptionHandlerSharded spreads the themes over several SubscriptionHandlerLockFree shards, each one with its
+// own thread-safe action handler: the operations on a theme stay serialized while different themes are handled in
+// parallel
+type SubscriptionHandlerSharded struct {
+	shards []*SubscriptionHandlerLockFree
+}
+
+// NewSubscriptionHandlerSharded initializes a new SubscriptionHandlerSharded with nShards shards, at least one
+func NewSubscriptionHandlerSharded(ctx context.Context, nShards int) *SubscriptionHandlerSharded {
+	if nShards < 1 {
+		nShards = 1
+	}
+	shards := make([]*SubscriptionHandlerLockFree, nShards)
+	for i := range shards {
+		shards[i] = NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	}
+	return &SubscriptionHandlerSharded{
+		shards: shards,
+	}
+}
+
+// shard returns the shard handling the theme
+func (s *SubscriptionHandlerSharded) shard(theme ActivityTheme) *SubscriptionHandlerLockFree {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(theme))
+	return s.shards[hash.Sum32()%uint32(len(s.shards))]
+}
+
+// AddNewSubscription creates a new subscription to a theme for the given user name
+func (s *SubscriptionHandlerSharded) AddNewSubscription(theme ActivityTheme, name PersonName) (SubscriptionID, error) {
+	return s.shard(theme).AddNewSubscription(theme, name)
+}
+
+// CountSubscriptionByTheme returns the number of subscriptions by theme
+func (s *SubscriptionHandlerSharded) CountSubscriptionByTheme(theme ActivityTheme) (int, error) {
+	return s.shard(theme).CountSubscriptionByTheme(theme)
+}
+
+// SubscriptionExists checks whether the subID subscription exists for the given theme
+func (s *SubscriptionHandlerSharded) SubscriptionExists(theme ActivityTheme, subID SubscriptionID) (bool, error) {
+	return s.shard(theme).SubscriptionExists(theme, subID)
+}
+
+// GetSubscriber returns the name of the person who subscribed to the theme with the subID subscription
+func (s *SubscriptionHandlerSharded) GetSubscriber(theme ActivityTheme, subID SubscriptionID) (PersonName, error) {
+	return s.shard(theme).GetSubscriber(theme, subID)
+}
+
+// RemoveSubscriptionSync deletes a the subscription associated to the subID for the given theme
+func (s *SubscriptionHandlerSharded) RemoveSubscriptionSync(theme ActivityTheme, subID SubscriptionID) error {
+	return s.shard(theme).RemoveSubscriptionSync(theme, subID)
+}
+
+// RemoveSubscriptionAsync sends a delete order to remove a the subscription associated to the subID for the given theme
+func (s *SubscriptionHandlerSharded) RemoveSubscriptionAsync(theme ActivityTheme, subID SubscriptionID) {
+	s.shard(theme).RemoveSubscriptionAsync(theme, subID)
+}
+
+// RemovePersonEverywhere deletes all the subscriptions of the person with the given name, whatever their theme.
+// Each shard is cleaned up in a single thread safe task, but the shards one after the other: the removal is not
+// atomic across the shards. Returns the number of removed subscriptions
+func (s *SubscriptionHandlerSharded) RemovePersonEverywhere(name PersonName) (int, error) {
+	total := 0
+	for _, shard := range s.shards {
+		nbRemoved, err := shard.RemovePersonEverywhere(name)
+		total += nbRemoved
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,129 @@
+package sub
+
+import (
+	"sync"
+)
+
+// themeWatcher calls onChange with the successive subscription counts of a theme, in order, from its own goroutine
+type themeWatcher struct {
+	onChange func(count int)
+	// lastCount is the last count notified, only accessed from the thread safe context
+	lastCount int
+	mutex     sync.Mutex
+	counts    []int
+	signal    chan struct{}
+	// stop is closed by the unwatch func, see WatchThemeCount
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// notify queues count for the watcher goroutine, never blocking the thread safe context
+func (w *themeWatcher) notify(count int) {
+	w.mutex.Lock()
+	w.counts = append(w.counts, count)
+	w.mutex.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+		// The watcher goroutine has already been signaled
+	}
+}
+
+// run calls onChange with the queued counts until the handler loop exits or the watcher is stopped
+func (w *themeWatcher) run(handlerDone <-chan struct{}) {
+	for {
+		select {
+		case <-handlerDone:
+			return
+		case <-w.stop:
+			return
+		case <-w.signal:
+		}
+		w.mutex.Lock()
+		counts := w.counts
+		w.counts = nil
+		w.mutex.Unlock()
+		for _, count := range counts {
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+			w.onChange(count)
+		}
+	}
+}
+
+type watchThemeCountArgs struct {
+	theme   ActivityTheme
+	watcher *themeWatcher
+}
+
+func (s *SubscriptionHandlerLockFree) watchThemeCountThreadSafe(args interface{}) (interface{}, error) {
+	watchArgs := args.(watchThemeCountArgs)
+	watchArgs.watcher.lastCount = len(s.subsByTheme[watchArgs.theme])
+	s.watchers[watchArgs.theme] = append(s.watchers[watchArgs.theme], watchArgs.watcher)
+	return nil, nil
+}
+
+func (s *SubscriptionHandlerLockFree) unwatchThemeCountThreadSafe(args interface{}) (interface{}, error) {
+	watchArgs := args.(watchThemeCountArgs)
+	watchers := s.watchers[watchArgs.theme]
+	for i, watcher := range watchers {
+		if watcher == watchArgs.watcher {
+			s.watchers[watchArgs.theme] = append(watchers[:i:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(s.watchers[watchArgs.theme]) == 0 {
+		delete(s.watchers, watchArgs.theme)
+	}
+	return nil, nil
+}
+
+// WatchThemeCount calls onChange with the new number of subscriptions of the theme each time it changes, until the
+// returned unwatch func is called or the handler loop exits, see action.ThreadSafeActionHandler.Done: the watcher
+// goroutine then exits. The changes are detected in the thread safe task changing the count, so none is missed,
+// while onChange is called from the watcher goroutine: it is called in the order of the changes and may call the
+// SubscriptionHandlerLockFree methods. onChange is not called anymore once unwatch has returned, unless it is being
+// called already. unwatch may be called several times.
+func (s *SubscriptionHandlerLockFree) WatchThemeCount(theme ActivityTheme, onChange func(count int)) (unwatch func(), err error) {
+	watcher := &themeWatcher{onChange: onChange, signal: make(chan struct{}, 1), stop: make(chan struct{})}
+	watchArgs := watchThemeCountArgs{
+		theme:   theme,
+		watcher: watcher,
+	}
+	// Register the watcher in a thread safe environment
+	_, err = s.threadSafeActionHandler.SynchronousActionSend(s.watchThemeCountThreadSafe, watchArgs)
+	if err != nil {
+		return nil, err
+	}
+	go watcher.run(s.threadSafeActionHandler.Done())
+	return func() {
+		watcher.stopOnce.Do(func() {
+			close(watcher.stop)
+			// Unregister the watcher in a thread safe environment, which may have been closed already
+			s.threadSafeActionHandler.AsynchronousActionSend(s.unwatchThemeCountThreadSafe, watchArgs)
+		})
+	}, nil
+}
+
+// notifyThemeWatchers notifies the watchers of the theme if its count has changed. Called from the thread safe
+// context by every task changing the subscriptions.
+func (s *SubscriptionHandlerLockFree) notifyThemeWatchers(theme ActivityTheme) {
+	count := len(s.subsByTheme[theme])
+	for _, watcher := range s.watchers[theme] {
+		if watcher.lastCount != count {
+			watcher.lastCount = count
+			watcher.notify(count)
+		}
+	}
+}
+
+// notifyAllWatchers notifies the watchers of every theme whose count has changed, for the tasks changing the
+// subscriptions of several themes at once
+func (s *SubscriptionHandlerLockFree) notifyAllWatchers() {
+	for theme := range s.watchers {
+		s.notifyThemeWatchers(theme)
+	}
+}
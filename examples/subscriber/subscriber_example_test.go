@@ -2,8 +2,12 @@ package main_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"runtime"
+	"sort"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -84,6 +88,456 @@ func Test_shouldBeAbleToSubscribeAndUnsubscribeConcurrently(t *testing.T) {
 
 }
 
+func Test_shouldBeAbleToQuerySubscriptionsWhileSubscribingConcurrently(t *testing.T) {
+	/*
+		- Start 100 concurrent subscription creations
+		- Query each created subscription as soon as it is created, while other subscriptions are being created
+	*/
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+
+	subCreatedChan := make(chan subCreatedInfo)
+	defer close(subCreatedChan)
+	nbUsers := 100
+
+	randomSubToBeDone := getRandomSubToBeDone(nbUsers)
+	concurrentCreateSubscriptions(subHandler, randomSubToBeDone, subCreatedChan)
+
+	names := map[sub.PersonName]bool{}
+	for i := 0; i < nbUsers; i++ {
+		createdSub := <-subCreatedChan
+		exists, err := subHandler.SubscriptionExists(createdSub.theme, createdSub.ID)
+		assert.NilError(t, err)
+		assert.Assert(t, exists)
+		name, err := subHandler.GetSubscriber(createdSub.theme, createdSub.ID)
+		assert.NilError(t, err)
+		names[name] = true
+	}
+	assert.Equal(t, len(names), nbUsers)
+}
+
+func Test_shouldNotFindUnknownSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+
+	subID, err := subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+
+	exists, err := subHandler.SubscriptionExists("theme 1", subID)
+	assert.NilError(t, err)
+	assert.Assert(t, !exists)
+	_, err = subHandler.GetSubscriber("theme 1", subID)
+	assert.Assert(t, errors.Is(err, sub.ErrSubscriptionNotFound))
+
+	assert.NilError(t, subHandler.RemoveSubscriptionSync("theme 0", subID))
+	exists, err = subHandler.SubscriptionExists("theme 0", subID)
+	assert.NilError(t, err)
+	assert.Assert(t, !exists)
+	_, err = subHandler.GetSubscriber("theme 0", subID)
+	assert.Assert(t, errors.Is(err, sub.ErrSubscriptionNotFound))
+}
+
+func Test_shouldListIndependentCopiesOfThemesAndSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+
+	sub0, err := subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+	sub1, err := subHandler.AddNewSubscription("theme 0", "Name 1")
+	assert.NilError(t, err)
+	_, err = subHandler.AddNewSubscription("theme 1", "Name 2")
+	assert.NilError(t, err)
+
+	themes, err := subHandler.ListThemes()
+	assert.NilError(t, err)
+	sort.Slice(themes, func(i, j int) bool { return themes[i] < themes[j] })
+	assert.DeepEqual(t, themes, []sub.ActivityTheme{"theme 0", "theme 1"})
+
+	subs, err := subHandler.ListSubscriptionsByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, subs, map[sub.SubscriptionID]sub.PersonName{sub0: "Name 0", sub1: "Name 1"})
+
+	// Mutating the returned copies must not change the handler state
+	themes[0] = "theme 2"
+	delete(subs, sub0)
+	subs[sub1] = "Someone else"
+	name, err := subHandler.GetSubscriber("theme 0", sub1)
+	assert.NilError(t, err)
+	assert.Equal(t, name, sub.PersonName("Name 1"))
+	count, err := subHandler.CountSubscriptionByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 2)
+	themes, err = subHandler.ListThemes()
+	assert.NilError(t, err)
+	assert.Equal(t, len(themes), 2)
+
+	subs, err = subHandler.ListSubscriptionsByTheme("unknown theme")
+	assert.NilError(t, err)
+	assert.Equal(t, len(subs), 0)
+}
+
+func Test_shouldNeverExceedTheSubscriptionLimitUnderConcurrency(t *testing.T) {
+	/*
+		- Start 100 concurrent subscription creations limited to 10 subscriptions by theme
+		- Only 10 of them must succeed for each theme
+	*/
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+	nbUsers := 100
+	limit := 10
+
+	randomSubToBeDone := getRandomSubToBeDone(nbUsers)
+	addedChan := make(chan bool, nbUsers)
+	for _, subToCreate := range randomSubToBeDone {
+		go func(s subToBeDoneInfo) {
+			_, added, err := subHandler.AddSubscriptionIfUnderLimit(s.theme, s.name, limit)
+			panicOnError(err)
+			addedChan <- added
+		}(subToCreate)
+	}
+	nbAdded := 0
+	for i := 0; i < nbUsers; i++ {
+		if <-addedChan {
+			nbAdded++
+		}
+	}
+
+	// 3 themes
+	assert.Equal(t, nbAdded, 3*limit)
+	for i := 0; i < 3; i++ {
+		count, err := subHandler.CountSubscriptionByTheme(sub.ActivityTheme(fmt.Sprintf("theme %d", i)))
+		assert.NilError(t, err)
+		assert.Equal(t, count, limit)
+	}
+	_, added, err := subHandler.AddSubscriptionIfUnderLimit("theme 0", "Name 100", limit+1)
+	assert.NilError(t, err)
+	assert.Assert(t, added)
+}
+
+func Test_shouldRemoveAllSubscriptionsOfAThemeAtOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+
+	nbSubs := 5
+	for i := 0; i < nbSubs; i++ {
+		_, err := subHandler.AddNewSubscription("theme 0", sub.PersonName(fmt.Sprintf("Name %d", i)))
+		assert.NilError(t, err)
+	}
+	_, err := subHandler.AddNewSubscription("theme 1", "Name 5")
+	assert.NilError(t, err)
+
+	nbRemoved, err := subHandler.RemoveAllSubscriptionsForTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, nbRemoved, nbSubs)
+	count, err := subHandler.CountSubscriptionByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+	count, err = subHandler.CountSubscriptionByTheme("theme 1")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+
+	nbRemoved, err = subHandler.RemoveAllSubscriptionsForTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, nbRemoved, 0)
+}
+
+// themesOfSubscription returns the themes of the exported state in which the subID subscription is registered
+func themesOfSubscription(state map[sub.ActivityTheme]map[sub.SubscriptionID]sub.PersonName, subID sub.SubscriptionID) []sub.ActivityTheme {
+	var themes []sub.ActivityTheme
+	for theme, subByID := range state {
+		if _, exists := subByID[subID]; exists {
+			themes = append(themes, theme)
+		}
+	}
+	return themes
+}
+
+func Test_shouldMoveASubscriptionAtomically(t *testing.T) {
+	/*
+		- Move a subscription back and forth between 2 themes
+		- Concurrently check it is always registered in exactly one theme
+	*/
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+
+	subID, err := subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+
+	nbMoves := 100
+	movesDone := make(chan bool)
+	go func() {
+		defer close(movesDone)
+		for i := 0; i < nbMoves; i++ {
+			from := sub.ActivityTheme(fmt.Sprintf("theme %d", i%2))
+			to := sub.ActivityTheme(fmt.Sprintf("theme %d", (i+1)%2))
+			panicOnError(subHandler.MoveSubscription(from, to, subID))
+		}
+	}()
+	moving := true
+	for moving {
+		select {
+		case <-movesDone:
+			moving = false
+		default:
+		}
+		// The exported state is taken at once: the subscription is in exactly one of its themes
+		state, err := subHandler.ExportState()
+		assert.NilError(t, err)
+		assert.Equal(t, len(themesOfSubscription(state, subID)), 1)
+	}
+
+	state, err := subHandler.ExportState()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, themesOfSubscription(state, subID), []sub.ActivityTheme{"theme 0"})
+	name, err := subHandler.GetSubscriber("theme 0", subID)
+	assert.NilError(t, err)
+	assert.Equal(t, name, sub.PersonName("Name 0"))
+	err = subHandler.MoveSubscription("theme 1", "theme 0", subID)
+	assert.Assert(t, errors.Is(err, sub.ErrSubscriptionNotFound))
+}
+
+func Test_shouldRemoveManySubscriptionsWithASingleBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+	nbUsers := 100
+	subCreatedChan := make(chan subCreatedInfo, nbUsers)
+	defer close(subCreatedChan)
+
+	concurrentCreateSubscriptions(subHandler, getRandomSubToBeDone(nbUsers), subCreatedChan)
+	var toRemove []sub.SubscriptionRef
+	for i := 0; i < nbUsers; i++ {
+		createdSub := <-subCreatedChan
+		toRemove = append(toRemove, sub.SubscriptionRef{Theme: createdSub.theme, SubID: createdSub.ID})
+	}
+
+	subHandler.RemoveSubscriptionsBatchAsync(toRemove)
+	// Wait for the batch to be applied instead of polling the counts
+	assert.NilError(t, threadSafeHandler.WaitIdle(ctx))
+	themes, err := subHandler.ListThemes()
+	assert.NilError(t, err)
+	assert.Equal(t, len(themes), 0)
+}
+
+func Test_shouldRenameASubscriberUnderConcurrentReads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	subID, err := subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+
+	nbRenames := 50
+	validNames := map[sub.PersonName]bool{"Name 0": true}
+	for i := 1; i <= nbRenames; i++ {
+		validNames[sub.PersonName(fmt.Sprintf("Name %d", i))] = true
+	}
+	stopReading := make(chan bool)
+	readersDone := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() {
+			defer func() { readersDone <- true }()
+			for {
+				select {
+				case <-stopReading:
+					return
+				default:
+				}
+				// The subscription is never observed missing nor with an unknown name while being renamed
+				name, err := subHandler.GetSubscriber("theme 0", subID)
+				panicOnError(err)
+				if !validNames[name] {
+					panic(fmt.Sprintf("unexpected subscriber name %s", name))
+				}
+			}
+		}()
+	}
+	for i := 1; i <= nbRenames; i++ {
+		assert.NilError(t, subHandler.UpdateSubscriberName("theme 0", subID, sub.PersonName(fmt.Sprintf("Name %d", i))))
+	}
+	close(stopReading)
+	for i := 0; i < 10; i++ {
+		<-readersDone
+	}
+
+	name, err := subHandler.GetSubscriber("theme 0", subID)
+	assert.NilError(t, err)
+	assert.Equal(t, name, sub.PersonName(fmt.Sprintf("Name %d", nbRenames)))
+	count, err := subHandler.CountSubscriptionByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+	assert.Assert(t, errors.Is(subHandler.UpdateSubscriberName("theme 1", subID, "Someone"), sub.ErrSubscriptionNotFound))
+}
+
+func Test_shouldGeneratePredictableIDsWithASequentialGenerator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	nextID := 0
+	sequentialIDGen := func() sub.SubscriptionID {
+		nextID++
+		return sub.SubscriptionID(fmt.Sprintf("sub-%d", nextID))
+	}
+	subHandler := sub.NewSubscriptionHandlerLockFreeWithIDGen(ctx, action.NewThreadSafeActionHandler(ctx), sequentialIDGen)
+
+	for i := 1; i <= 3; i++ {
+		subID, err := subHandler.AddNewSubscription("theme 0", sub.PersonName(fmt.Sprintf("Name %d", i)))
+		assert.NilError(t, err)
+		assert.Equal(t, subID, sub.SubscriptionID(fmt.Sprintf("sub-%d", i)))
+	}
+	subID, added, err := subHandler.AddSubscriptionIfUnderLimit("theme 1", "Name 4", 1)
+	assert.NilError(t, err)
+	assert.Assert(t, added)
+	assert.Equal(t, subID, sub.SubscriptionID("sub-4"))
+	name, err := subHandler.GetSubscriber("theme 0", "sub-2")
+	assert.NilError(t, err)
+	assert.Equal(t, name, sub.PersonName("Name 2"))
+}
+
+func Test_shouldCountAllSubscriptionsConsistently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	nbUsers := 100
+	subCreatedChan := make(chan subCreatedInfo, nbUsers)
+	defer close(subCreatedChan)
+
+	concurrentCreateSubscriptions(subHandler, getRandomSubToBeDone(nbUsers), subCreatedChan)
+	createdSubs := make([]subCreatedInfo, nbUsers)
+	for i := range createdSubs {
+		createdSubs[i] = <-subCreatedChan
+	}
+	sumByTheme, err := getCountUntilAllSubscribed(subHandler, nbUsers)
+	assert.NilError(t, err)
+	total, err := subHandler.CountAllSubscriptions()
+	assert.NilError(t, err)
+	assert.Equal(t, total, sumByTheme)
+
+	// Moving the subscriptions between themes keeps the total unchanged at any moment
+	movesDone := make(chan bool)
+	for _, createdSub := range createdSubs {
+		go func(s subCreatedInfo) {
+			panicOnError(subHandler.MoveSubscription(s.theme, "moved theme", s.ID))
+			movesDone <- true
+		}(createdSub)
+	}
+	for i := 0; i < nbUsers; i++ {
+		total, err := subHandler.CountAllSubscriptions()
+		assert.NilError(t, err)
+		assert.Equal(t, total, nbUsers)
+	}
+	for i := 0; i < nbUsers; i++ {
+		<-movesDone
+	}
+	count, err := subHandler.CountSubscriptionByTheme("moved theme")
+	assert.NilError(t, err)
+	assert.Equal(t, count, nbUsers)
+}
+
+func Test_shouldRoundTripTheExportedState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	nbUsers := 100
+	subCreatedChan := make(chan subCreatedInfo, nbUsers)
+	defer close(subCreatedChan)
+
+	concurrentCreateSubscriptions(subHandler, getRandomSubToBeDone(nbUsers), subCreatedChan)
+	for i := 0; i < nbUsers; i++ {
+		<-subCreatedChan
+	}
+	state, err := subHandler.ExportState()
+	assert.NilError(t, err)
+	assert.Equal(t, len(state), 3)
+
+	// Mutating the exported copy must not change the handler state
+	exportedCount := len(state["theme 0"])
+	for subID := range state["theme 0"] {
+		delete(state["theme 0"], subID)
+		break
+	}
+	count, err := subHandler.CountSubscriptionByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, exportedCount)
+
+	restoredHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	assert.NilError(t, restoredHandler.ImportState(state))
+	// Mutating the imported state must not change the handler state either
+	delete(state, "theme 1")
+	total := 0
+	for i := 0; i < 3; i++ {
+		theme := sub.ActivityTheme(fmt.Sprintf("theme %d", i))
+		expected, err := subHandler.CountSubscriptionByTheme(theme)
+		assert.NilError(t, err)
+		if i == 0 {
+			expected--
+		}
+		count, err := restoredHandler.CountSubscriptionByTheme(theme)
+		assert.NilError(t, err)
+		assert.Equal(t, count, expected)
+		total += count
+	}
+	assert.Equal(t, total, nbUsers-1)
+}
+
+func Test_shouldCountSubscriptionsAcrossShardsConcurrently(t *testing.T) {
+	/*
+		Same scenario as Test_shouldBeAbleToSubscribeAndCountSubscriptionConcurrentlyThenDelete with the themes
+		spread over several shards
+	*/
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	var subHandler sub.SubscriptionHandler = sub.NewSubscriptionHandlerSharded(ctx, 3)
+	nbUsers := 100
+	subCreatedChan := make(chan subCreatedInfo, nbUsers)
+	defer close(subCreatedChan)
+
+	randomSubToBeDone := getRandomSubToBeDone(nbUsers)
+	concurrentCreateSubscriptions(subHandler, randomSubToBeDone, subCreatedChan)
+
+	nbSubscriptions, err := getCountUntilAllSubscribed(subHandler, len(randomSubToBeDone))
+	assert.NilError(t, err)
+	assert.Equal(t, nbSubscriptions, nbUsers)
+	for i := 0; i < 3; i++ {
+		count, err := subHandler.CountSubscriptionByTheme(sub.ActivityTheme(fmt.Sprintf("theme %d", i)))
+		assert.NilError(t, err)
+		// getRandomSubToBeDone spreads the users evenly over the themes
+		assert.Assert(t, count == nbUsers/3 || count == nbUsers/3+1)
+	}
+
+	concurrentDeleteSubscriptions(subHandler, subCreatedChan, nbUsers)
+	nbSubscriptions, err = getCountUntilAllSubscribed(subHandler, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, nbSubscriptions, 0)
+}
+
+func Test_shouldHandleTheSubscriptionsWithAtLeastOneShard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	for _, nShards := range []int{0, -1} {
+		subHandler := sub.NewSubscriptionHandlerSharded(ctx, nShards)
+		subID, err := subHandler.AddNewSubscription("theme 0", "Alice")
+		assert.NilError(t, err)
+		exists, err := subHandler.SubscriptionExists("theme 0", subID)
+		assert.NilError(t, err)
+		assert.Assert(t, exists)
+		count, err := subHandler.CountSubscriptionByTheme("theme 0")
+		assert.NilError(t, err)
+		assert.Equal(t, count, 1)
+	}
+}
+
 type subToBeDoneInfo struct {
 	theme sub.ActivityTheme
 	name  sub.PersonName
@@ -160,3 +614,501 @@ func panicOnError(err error) {
 		panic(err)
 	}
 }
+
+func Test_shouldReturnTheFullRecordOfANewSubscription(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+
+	before := time.Now()
+	var previous sub.Subscription
+	for i := 0; i < 10; i++ {
+		name := sub.PersonName(fmt.Sprintf("Name %d", i))
+		subscription, err := subHandler.SubscribeDetailed("theme 0", name)
+		assert.NilError(t, err)
+		assert.Equal(t, subscription.Theme, sub.ActivityTheme("theme 0"))
+		assert.Equal(t, subscription.Name, name)
+		assert.Assert(t, !subscription.CreatedAt.Before(before))
+		assert.Assert(t, !subscription.CreatedAt.Before(previous.CreatedAt))
+		storedName, err := subHandler.GetSubscriber("theme 0", subscription.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, storedName, name)
+		previous = subscription
+	}
+	assert.Assert(t, !time.Now().Before(previous.CreatedAt))
+}
+
+func Test_shouldReplaceAllTheSubscribersOfATheme(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+
+	keptID, err := subHandler.AddNewSubscription("theme 0", "Kept")
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := subHandler.AddNewSubscription("theme 0", sub.PersonName(fmt.Sprintf("Name %d", i)))
+		assert.NilError(t, err)
+	}
+	otherID, err := subHandler.AddNewSubscription("theme 1", "Other")
+	assert.NilError(t, err)
+
+	replacement := map[sub.SubscriptionID]sub.PersonName{keptID: "Kept renamed", "imported-1": "Imported 1", "imported-2": "Imported 2"}
+	added, removed, err := subHandler.ReplaceThemeSubscribers("theme 0", replacement)
+	assert.NilError(t, err)
+	assert.Equal(t, added, 2)
+	assert.Equal(t, removed, 3)
+	// The handler keeps its own copy
+	replacement["imported-3"] = "Imported 3"
+
+	subs, err := subHandler.ListSubscriptionsByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, subs, map[sub.SubscriptionID]sub.PersonName{keptID: "Kept renamed", "imported-1": "Imported 1", "imported-2": "Imported 2"})
+	count, err := subHandler.CountSubscriptionByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 3)
+	exists, err := subHandler.SubscriptionExists("theme 1", otherID)
+	assert.NilError(t, err)
+	assert.Assert(t, exists)
+
+	added, removed, err = subHandler.ReplaceThemeSubscribers("theme 0", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, added, 0)
+	assert.Equal(t, removed, 3)
+	themes, err := subHandler.ListThemes()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, themes, []sub.ActivityTheme{"theme 1"})
+}
+
+func Test_shouldVisitAConsistentSnapshotOfTheSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	nbUsers := 100
+	subCreatedChan := make(chan subCreatedInfo, nbUsers)
+	defer close(subCreatedChan)
+
+	concurrentCreateSubscriptions(subHandler, getRandomSubToBeDone(nbUsers), subCreatedChan)
+	created := map[sub.SubscriptionID]sub.ActivityTheme{}
+	for i := 0; i < nbUsers; i++ {
+		createdSub := <-subCreatedChan
+		created[createdSub.ID] = createdSub.theme
+	}
+
+	visited := map[sub.SubscriptionID]sub.ActivityTheme{}
+	err := subHandler.ForEachSubscription(func(theme sub.ActivityTheme, subID sub.SubscriptionID, _ sub.PersonName) {
+		visited[subID] = theme
+	})
+	assert.NilError(t, err)
+	total, err := subHandler.CountAllSubscriptions()
+	assert.NilError(t, err)
+	assert.Equal(t, len(visited), total)
+	assert.DeepEqual(t, visited, created)
+}
+
+func Test_shouldCountTheSubscriptionsOfAllThemesConsistently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	nbUsers := 100
+	subCreatedChan := make(chan subCreatedInfo, nbUsers)
+	defer close(subCreatedChan)
+
+	concurrentCreateSubscriptions(subHandler, getRandomSubToBeDone(nbUsers), subCreatedChan)
+	createdSubs := make([]subCreatedInfo, nbUsers)
+	for i := range createdSubs {
+		createdSubs[i] = <-subCreatedChan
+	}
+
+	// Moving the subscriptions between themes changes the counts by theme but never their sum
+	movesDone := make(chan bool)
+	for _, createdSub := range createdSubs {
+		go func(s subCreatedInfo) {
+			panicOnError(subHandler.MoveSubscription(s.theme, "moved theme", s.ID))
+			movesDone <- true
+		}(createdSub)
+	}
+	for i := 0; i < nbUsers; i++ {
+		countByTheme, err := subHandler.CountByAllThemes()
+		assert.NilError(t, err)
+		sum := 0
+		for _, count := range countByTheme {
+			sum += count
+		}
+		total, err := subHandler.CountAllSubscriptions()
+		assert.NilError(t, err)
+		assert.Equal(t, sum, total)
+		assert.Equal(t, sum, nbUsers)
+	}
+	for i := 0; i < nbUsers; i++ {
+		<-movesDone
+	}
+	countByTheme, err := subHandler.CountByAllThemes()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, countByTheme, map[sub.ActivityTheme]int{"moved theme": nbUsers})
+}
+
+func Test_shouldReportWhetherASubscriptionHasBeenRemoved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+
+	subID, err := subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+	removed, err := subHandler.RemoveSubscriptionSyncExists("theme 0", "unknown")
+	assert.NilError(t, err)
+	assert.Assert(t, !removed)
+	removed, err = subHandler.RemoveSubscriptionSyncExists("theme 1", subID)
+	assert.NilError(t, err)
+	assert.Assert(t, !removed)
+
+	removed, err = subHandler.RemoveSubscriptionSyncExists("theme 0", subID)
+	assert.NilError(t, err)
+	assert.Assert(t, removed)
+	// Removing it again is a no-op
+	removed, err = subHandler.RemoveSubscriptionSyncExists("theme 0", subID)
+	assert.NilError(t, err)
+	assert.Assert(t, !removed)
+	themes, err := subHandler.ListThemes()
+	assert.NilError(t, err)
+	assert.Equal(t, len(themes), 0)
+}
+
+func Test_shouldGiveUpOnTheCallContextWithoutChangingTheSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	threadSafeHandler := action.NewThreadSafeActionHandler(ctx)
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, threadSafeHandler)
+	subID, err := subHandler.AddNewSubscriptionCtx(context.TODO(), "theme 0", "Name 0")
+	assert.NilError(t, err)
+
+	// Keep the handler busy so that the next calls wait for it
+	started := make(chan struct{})
+	release := make(chan struct{})
+	threadSafeHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+
+	callCtx, cancelCall := context.WithCancel(context.TODO())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := subHandler.AddNewSubscriptionCtx(callCtx, "theme 0", "Name 1")
+		errs <- err
+	}()
+	go func() {
+		errs <- subHandler.RemoveSubscriptionSyncCtx(callCtx, "theme 0", subID)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancelCall()
+	assert.Assert(t, errors.Is(<-errs, context.Canceled))
+	assert.Assert(t, errors.Is(<-errs, context.Canceled))
+	close(release)
+
+	// The cancelled calls have not been executed
+	count, err := subHandler.CountSubscriptionByThemeCtx(context.TODO(), "theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+	exists, err := subHandler.SubscriptionExistsCtx(context.TODO(), "theme 0", subID)
+	assert.NilError(t, err)
+	assert.Assert(t, exists)
+	name, err := subHandler.GetSubscriberCtx(callCtx, "theme 0", subID)
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, name, sub.PersonName(""))
+}
+
+func Test_shouldResetAllTheSubscriptionsAtOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	for i := 0; i < 9; i++ {
+		_, err := subHandler.AddNewSubscription(sub.ActivityTheme(fmt.Sprintf("theme %d", i%3)), sub.PersonName(fmt.Sprintf("Name %d", i)))
+		assert.NilError(t, err)
+	}
+
+	assert.NilError(t, subHandler.ResetAll())
+	count, err := subHandler.CountAllSubscriptions()
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+	themes, err := subHandler.ListThemes()
+	assert.NilError(t, err)
+	assert.Equal(t, len(themes), 0)
+
+	// The handler keeps working after the reset
+	_, err = subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+	count, err = subHandler.CountAllSubscriptions()
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+}
+
+func Test_shouldNotifyTheWatchersOfEveryThemeCountChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	_, err := subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+
+	counts := make(chan int, 10)
+	unwatch, err := subHandler.WatchThemeCount("theme 0", func(count int) {
+		counts <- count
+	})
+	assert.NilError(t, err)
+	defer unwatch()
+	subID, err := subHandler.AddNewSubscription("theme 0", "Name 1")
+	assert.NilError(t, err)
+	// The other themes are not watched
+	_, err = subHandler.AddNewSubscription("theme 1", "Name 2")
+	assert.NilError(t, err)
+	// Renaming a subscriber does not change the count
+	assert.NilError(t, subHandler.UpdateSubscriberName("theme 0", subID, "Name 3"))
+	assert.NilError(t, subHandler.RemoveSubscriptionSync("theme 0", subID))
+	_, err = subHandler.RemoveAllSubscriptionsForTheme("theme 0")
+	assert.NilError(t, err)
+
+	for _, expected := range []int{2, 1, 0} {
+		select {
+		case count := <-counts:
+			assert.Equal(t, count, expected)
+		case <-time.After(time.Second):
+			t.Fatalf("the watcher has not been notified of the count %d", expected)
+		}
+	}
+	select {
+	case count := <-counts:
+		t.Fatalf("unexpected notification of the count %d", count)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// waitGoroutines waits for the number of goroutines to drop to at most expected
+func waitGoroutines(t *testing.T, expected int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are running, expected at most %d", runtime.NumGoroutine(), expected)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_shouldStopTheWatcherOnUnwatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	goroutines := runtime.NumGoroutine()
+
+	counts := make(chan int, 10)
+	unwatch, err := subHandler.WatchThemeCount("theme 0", func(count int) {
+		counts <- count
+	})
+	assert.NilError(t, err)
+	unwatch()
+	// unwatch may be called several times
+	unwatch()
+	waitGoroutines(t, goroutines)
+
+	_, err = subHandler.AddNewSubscription("theme 0", "Name 0")
+	assert.NilError(t, err)
+	select {
+	case count := <-counts:
+		t.Fatalf("unexpected notification of the count %d", count)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func Test_shouldStopTheWatcherOnceTheHandlerIsClosed(t *testing.T) {
+	handler := action.NewThreadSafeActionHandler(context.TODO())
+	subHandler := sub.NewSubscriptionHandlerLockFree(context.TODO(), handler)
+	goroutines := runtime.NumGoroutine()
+
+	_, err := subHandler.WatchThemeCount("theme 0", func(int) {})
+	assert.NilError(t, err)
+	assert.NilError(t, handler.Close())
+	// The handler loop has exited as well
+	waitGoroutines(t, goroutines-1)
+}
+
+func Test_shouldCreateManySubscriptionsInASingleCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	nbNames := 50
+	names := make([]sub.PersonName, nbNames)
+	for i := range names {
+		names[i] = sub.PersonName(fmt.Sprintf("Name %d", i))
+	}
+
+	subIDs, err := subHandler.AddNewSubscriptionsBulk("theme 0", names)
+	assert.NilError(t, err)
+	assert.Equal(t, len(subIDs), nbNames)
+	unique := map[sub.SubscriptionID]bool{}
+	for i, subID := range subIDs {
+		unique[subID] = true
+		name, err := subHandler.GetSubscriber("theme 0", subID)
+		assert.NilError(t, err)
+		assert.Equal(t, name, names[i])
+	}
+	assert.Equal(t, len(unique), nbNames)
+	count, err := subHandler.CountSubscriptionByTheme("theme 0")
+	assert.NilError(t, err)
+	assert.Equal(t, count, nbNames)
+
+	// No name creates no theme
+	subIDs, err = subHandler.AddNewSubscriptionsBulk("theme 1", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(subIDs), 0)
+	themes, err := subHandler.ListThemes()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, themes, []sub.ActivityTheme{"theme 0"})
+}
+
+func Test_shouldRemoveAPersonFromEveryThemeAtOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	lockFree := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	for _, subHandler := range []sub.SubscriptionHandler{lockFree, sub.NewSubscriptionHandlerSharded(ctx, 3)} {
+		for i := 0; i < 4; i++ {
+			_, err := subHandler.AddNewSubscription(sub.ActivityTheme(fmt.Sprintf("theme %d", i)), "Alice")
+			assert.NilError(t, err)
+		}
+		// Alice may subscribe twice to the same theme
+		_, err := subHandler.AddNewSubscription("theme 0", "Alice")
+		assert.NilError(t, err)
+		_, err = subHandler.AddNewSubscription("theme 0", "Bob")
+		assert.NilError(t, err)
+
+		removed, err := subHandler.RemovePersonEverywhere("Alice")
+		assert.NilError(t, err)
+		assert.Equal(t, removed, 5)
+		count, err := subHandler.CountSubscriptionByTheme("theme 0")
+		assert.NilError(t, err)
+		assert.Equal(t, count, 1)
+		for i := 1; i < 4; i++ {
+			count, err := subHandler.CountSubscriptionByTheme(sub.ActivityTheme(fmt.Sprintf("theme %d", i)))
+			assert.NilError(t, err)
+			assert.Equal(t, count, 0)
+		}
+		removed, err = subHandler.RemovePersonEverywhere("Alice")
+		assert.NilError(t, err)
+		assert.Equal(t, removed, 0)
+	}
+	// The empty themes are cleaned up
+	themes, err := lockFree.ListThemes()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, themes, []sub.ActivityTheme{"theme 0"})
+}
+
+func Test_shouldNotLoseAnyConcurrentThemeCounterAdjustment(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+
+	nbWorkers := 20
+	nbAdjustments := 100
+	errs := make(chan error, nbWorkers)
+	expected := 0
+	for worker := 0; worker < nbWorkers; worker++ {
+		delta := worker - 5
+		expected += delta * nbAdjustments
+		go func() {
+			for i := 0; i < nbAdjustments; i++ {
+				if _, err := subHandler.AdjustThemeCounter("theme 0", delta); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for worker := 0; worker < nbWorkers; worker++ {
+		assert.NilError(t, <-errs)
+	}
+
+	value, err := subHandler.AdjustThemeCounter("theme 0", 0)
+	assert.NilError(t, err)
+	assert.Equal(t, value, expected)
+	// The counters of the other themes are independent
+	value, err = subHandler.AdjustThemeCounter("theme 1", -3)
+	assert.NilError(t, err)
+	assert.Equal(t, value, -3)
+}
+
+func Test_shouldComputeConsistentValuesFromTheSameSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+
+	nbSubscriptions := 300
+	go func() {
+		for i := 0; i < nbSubscriptions; i++ {
+			_, _ = subHandler.AddNewSubscription(sub.ActivityTheme(fmt.Sprintf("theme %d", i%7)), sub.PersonName(fmt.Sprintf("Name %d", i)))
+		}
+	}()
+	countSubscriptions := func(state map[sub.ActivityTheme]map[sub.SubscriptionID]sub.PersonName) (interface{}, error) {
+		total := 0
+		for _, subByID := range state {
+			total += len(subByID)
+		}
+		return total, nil
+	}
+	countNames := func(state map[sub.ActivityTheme]map[sub.SubscriptionID]sub.PersonName) (interface{}, error) {
+		names := map[sub.PersonName]bool{}
+		for _, subByID := range state {
+			for _, name := range subByID {
+				names[name] = true
+			}
+		}
+		return len(names), nil
+	}
+	for {
+		results, err := subHandler.ComputeFromSnapshot(countSubscriptions, countNames)
+		assert.NilError(t, err)
+		// Each name has a single subscription: both computations agree as they see the same subscriptions
+		assert.Equal(t, results[0], results[1])
+		if results[0] == nbSubscriptions {
+			break
+		}
+	}
+}
+
+func Test_shouldAlwaysCountAConsistentNumberOfSubscriptionsUnderHeavyWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	subHandler := sub.NewSubscriptionHandlerLockFree(ctx, action.NewThreadSafeActionHandler(ctx))
+	nbWriters := 20
+	nbRounds := 50
+	var created int64
+
+	writesDone := make(chan bool)
+	for i := 0; i < nbWriters; i++ {
+		go func(name sub.PersonName) {
+			for round := 0; round < nbRounds; round++ {
+				atomic.AddInt64(&created, 1)
+				subID, err := subHandler.AddNewSubscription("stress theme", name)
+				panicOnError(err)
+				if round%2 == 0 {
+					panicOnError(subHandler.RemoveSubscriptionSync("stress theme", subID))
+				}
+			}
+			writesDone <- true
+		}(sub.PersonName(fmt.Sprintf("writer %d", i)))
+	}
+
+	for finished := 0; finished < nbWriters; {
+		select {
+		case <-writesDone:
+			finished++
+		default:
+		}
+		// A subscription is counted once its creation is started, so the count never exceeds the created ones
+		count, err := subHandler.CountSubscriptionByTheme("stress theme")
+		assert.NilError(t, err)
+		assert.Assert(t, count >= 0 && int64(count) <= atomic.LoadInt64(&created),
+			"count %d out of [0, %d]", count, atomic.LoadInt64(&created))
+	}
+	count, err := subHandler.CountSubscriptionByTheme("stress theme")
+	assert.NilError(t, err)
+	assert.Equal(t, count, nbWriters*nbRounds/2)
+}
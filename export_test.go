@@ -0,0 +1,61 @@
+package action
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// PendingTasks exposes to the tests the number of tasks submitted but neither executed nor rejected yet
+func PendingTasks(h *ThreadSafeActionHandler) int {
+	return int(atomic.LoadInt64(&h.pending))
+}
+
+// DetachedActionSendHandOver accounts a task as submitted like DetachedActionSend, and returns the function handing
+// it over to the handler loop that DetachedActionSend calls from its own goroutine
+func DetachedActionSendHandOver(h *ThreadSafeActionHandler, task ThreadSafeTask) func() {
+	return h.acquireDetached(task, nil)
+}
+
+// Stepper lets the tests control when the handler loop takes the next action, to make timing-dependent tests
+// deterministic
+type Stepper struct {
+	step    chan struct{}
+	stepped chan struct{}
+}
+
+// NewStepper creates a new Stepper, to give to a single handler with WithStepper
+func NewStepper() *Stepper {
+	return &Stepper{step: make(chan struct{}), stepped: make(chan struct{})}
+}
+
+// WithStepper makes the handler loop take the actions only when allowed by StepNext
+func WithStepper(s *Stepper) Option {
+	return withStepper(s.step, s.stepped)
+}
+
+// StepNext allows the handler loop to take exactly one action, waiting for an action to be submitted if none is, and
+// returns once it has been dispatched: executed, discarded or started in its own goroutine for a read or offloaded
+// task. A Flush barrier is an action as well. The follow-ups scheduled by the action are executed in the same step,
+// see ScheduleAfter.
+func (s *Stepper) StepNext() {
+	s.step <- struct{}{}
+	<-s.stepped
+}
+
+// SendAbandoned sends a synchronous action whose caller never receives the reply, its reply channel being
+// unbuffered, and returns once the handler loop has accepted it
+func SendAbandoned(h *ThreadSafeActionHandler, task ThreadSafeTask) error {
+	return h.sendAction(h.handlerCtx(), &ctrlAction{
+		sync: true,
+		ctrlThreadSafeCtx: controlThreadSafeContext{
+			ctx:  h.handlerCtx(),
+			task: task,
+		},
+		ctrlReplyChannel: make(chan taskReply),
+	})
+}
+
+// ShutdownOnSignal is InstallSignalHandler receiving the signals from signals instead of the OS
+func ShutdownOnSignal(h *ThreadSafeActionHandler, signals <-chan os.Signal) func() {
+	return shutdownOnSignal(h, signals)
+}
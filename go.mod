@@ -1,9 +1,13 @@
 module github.com/sbracaloni/thread-safe-action
 
-go 1.15
+go 1.18
+
+require (
+	golang.org/x/sync v0.1.0
+	gotest.tools v2.2.0+incompatible
+)
 
 require (
 	github.com/google/go-cmp v0.5.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	gotest.tools v2.2.0+incompatible
 )
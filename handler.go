@@ -2,8 +2,119 @@ package action
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	// ErrNilTask is returned when a nil ThreadSafeTask is sent to the handler
+	ErrNilTask = errors.New("thread-safe task is nil")
+	// ErrHandlerStopped is matched by every error returned because the handler does not execute tasks anymore,
+	// its context being done or the handler being closed. See HandlerError
+	ErrHandlerStopped = errors.New("thread-safe action handler is stopped")
+	// ErrHandlerClosed is returned when a task is sent to a closed handler
+	ErrHandlerClosed = errors.New("thread-safe action handler is closed")
+	// ErrTooManyPending is returned when the maximum number of waiting synchronous sends is reached
+	ErrTooManyPending = errors.New("too many pending synchronous sends")
+	// ErrReentrantSend is returned when a thread-safe task waits for a task of its own handler, which would deadlock
+	ErrReentrantSend = errors.New("thread-safe task cannot wait for its own handler")
+	// ErrQueueFull is returned when an asynchronous task is rejected by the QueueDropNewest policy
+	ErrQueueFull = errors.New("thread-safe action handler queue is full")
+	// ErrTaskDropped is returned when a queued task is evicted by the QueueDropOldest policy
+	ErrTaskDropped = errors.New("thread-safe task dropped from the full queue")
+	// ErrTaskPanic is matched by the error returned to a synchronous send whose task panicked
+	ErrTaskPanic = errors.New("thread-safe task panicked")
+	// ErrActionTimeout is returned when a task runs longer than the default task timeout, see WithDefaultTaskTimeout
+	ErrActionTimeout = errors.New("thread-safe task timed out")
+	// ErrTaskCancelled is reported when a task is cancelled before being started, see AsynchronousActionSendCancelable
+	ErrTaskCancelled = errors.New("thread-safe task cancelled")
+	// ErrDrainTimeout is returned when the shutdown context is done before all the submitted tasks are executed
+	ErrDrainTimeout = errors.New("thread-safe action handler drain timed out")
+	// ErrOverloaded is returned when a synchronous send is shed because too many tasks are queued, see
+	// WithLoadShedding
+	ErrOverloaded = errors.New("thread-safe action handler is overloaded")
+	// ErrHandlerRunning is returned when restarting a handler whose loop is still running
+	ErrHandlerRunning = errors.New("thread-safe action handler is still running")
+	// ErrNothingToRollback is returned by RollbackLast when no rollback is stored
+	ErrNothingToRollback = errors.New("no thread-safe task to roll back")
+	// ErrNotInTask is returned by ScheduleAfter when not called from a running task of the handler
+	ErrNotInTask = errors.New("thread-safe follow-up must be scheduled from a task of its handler")
+	// ErrCircuitOpen is returned when the circuit breaker rejects the task class, see WithCircuitBreaker
+	ErrCircuitOpen = errors.New("thread-safe task class circuit is open")
+	// ErrLoopPanic is matched by the error reported for the action being dispatched when the handler loop panics,
+	// see WithAutoRecover
+	ErrLoopPanic = errors.New("thread-safe action handler loop panicked")
+	// ErrArgsCopy is matched by the error returned by GobCopy when the task args cannot be copied, see WithArgCopy
+	ErrArgsCopy = errors.New("thread-safe task args cannot be copied")
+)
+
+// HandlerError is returned when a task cannot be executed because the handler is stopped.
+// It identifies the handler by its name (see WithName) and matches ErrHandlerStopped with errors.Is.
+type HandlerError struct {
+	// Name is the handler name, empty for an unnamed handler
+	Name string
+	// Err is ErrHandlerClosed or the handler context error
+	Err error
+}
+
+func (e *HandlerError) Error() string {
+	if e.Name == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("thread-safe action handler %q: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the cause of the error
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrHandlerStopped
+func (e *HandlerError) Is(target error) bool {
+	return target == ErrHandlerStopped
+}
+
+// ActionError wraps the error returned by a task, or its panic, with the context of its execution.
+// The task error is still matched by errors.Is and errors.As through the wrapper.
+type ActionError struct {
+	// Name is the handler name, empty for an unnamed handler
+	Name string
+	// ID is the correlation ID of the task, empty for a task sent without ID, see WithID
+	ID string
+	// Sync is true when the task has been sent synchronously
+	Sync bool
+	// Elapsed is the time spent executing the task
+	Elapsed time.Duration
+	// Err is the task error
+	Err error
+}
+
+func (e *ActionError) Error() string {
+	mode := "asynchronous"
+	if e.Sync {
+		mode = "synchronous"
+	}
+	if e.ID != "" {
+		mode = fmt.Sprintf("%s %q", mode, e.ID)
+	}
+	if e.Name == "" {
+		return fmt.Sprintf("%s thread-safe task failed after %v: %v", mode, e.Elapsed, e.Err)
+	}
+	return fmt.Sprintf("thread-safe action handler %q: %s task failed after %v: %v", e.Name, mode, e.Elapsed, e.Err)
+}
+
+// Unwrap returns the task error
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
 // ThreadSafeActionHandlerIft interface exposing the 2 main methods
 type ThreadSafeActionHandlerIft interface {
 	// SynchronousActionSend a task to be executed in a thread-safe context
@@ -15,123 +126,996 @@ type ThreadSafeActionHandlerIft interface {
 // ThreadSafeTask is executed in a thread safe context
 type ThreadSafeTask func(interface{}) (interface{}, error)
 
+// ThreadSafeTaskCtx is executed in a thread safe context and receives the context of the call, carrying its
+// request-scoped values
+type ThreadSafeTaskCtx func(ctx context.Context, args interface{}) (interface{}, error)
+
 type controlThreadSafeContext struct {
-	controlFunc ThreadSafeTask
-	args        interface{}
+	// ctx is the context the task is executed for
+	ctx         context.Context
+	controlFunc ThreadSafeTaskCtx
+	// task is set instead of controlFunc for the tasks ignoring the context, sparing the adapter allocation
+	task ThreadSafeTask
+	args interface{}
+}
+
+// taskPanic is the error reported when a task panics, carrying the recovered value
+type taskPanic struct {
+	value interface{}
+	stack []byte
 }
 
-func (c controlThreadSafeContext) execute() (interface{}, error) {
-	return c.controlFunc(c.args)
+func (p *taskPanic) Error() string {
+	return fmt.Sprintf("thread-safe task panicked: %v", p.value)
+}
+
+// Is reports whether target is ErrTaskPanic
+func (p *taskPanic) Is(target error) bool {
+	return target == ErrTaskPanic
+}
+
+// execute runs the task with ctx through the middlewares, recovering from any panic so that the handler loop
+// keeps running
+func (c controlThreadSafeContext) execute(ctx context.Context, middlewares []Middleware) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result, err = nil, &taskPanic{value: recovered, stack: debug.Stack()}
+		}
+	}()
+	if c.task != nil {
+		if len(middlewares) == 0 {
+			return c.task(c.args)
+		}
+		return chainMiddlewares(middlewares, c.task)(c.args)
+	}
+	if len(middlewares) == 0 {
+		return c.controlFunc(ctx, c.args)
+	}
+	return chainMiddlewares(middlewares, func(args interface{}) (interface{}, error) {
+		return c.controlFunc(ctx, args)
+	})(c.args)
+}
+
+// taskReply is the outcome of a task, sent back to its synchronous caller as a single value whatever the result
+// and the error are
+type taskReply struct {
+	result interface{}
+	err    error
 }
 
 type ctrlAction struct {
-	ctrlThreadSafeCtx  controlThreadSafeContext
-	sync               bool
-	ctrlErrorChannel   chan error
-	ctrlChannelReplies chan interface{}
+	ctrlThreadSafeCtx controlThreadSafeContext
+	sync              bool
+	// internal actions are handler bookkeeping: they are not instrumented like user tasks
+	internal bool
+	// read actions only read the state: they run concurrently with each other, but never with other actions
+	read bool
+	// offload actions run in their own goroutine, concurrently with any other action, see WithOffload
+	offload bool
+	// partial synchronous callers wait for the started task whatever their context, see SynchronousActionSendPartial
+	partial          bool
+	ctrlReplyChannel chan taskReply
+	// replied is set once the reply has been sent on ctrlReplyChannel
+	replied uint32
+	// released is set once the action is no longer accounted as in flight, see release
+	released uint32
+	// argsErr is the error of the args copy of an asynchronous action, discarded instead of executed, see WithArgCopy
+	argsErr error
+	// state is actionQueued until the handler loop starts the action, unless it has been cancelled before
+	state int32
+	// onDone, when set, is called from the handler loop once the action has been executed and released, or with
+	// executed false and the discard reason as error once it has been discarded
+	onDone func(reply taskReply, executed bool)
+	// class is the class the task has been tagged with, see WithClass
+	class string
+	// id is the correlation ID the task has been tagged with, see WithID
+	id string
+	// enqueuedAt is the submission time of the action, only set when a LatencyCollector is set
+	enqueuedAt time.Time
+	// size is the size of the args accounted in the queued bytes, see WithMaxQueueBytes
+	size int64
+	// behind is the exclusive task running when the synchronous action has been sent, see sentByRunningTask
+	behind *ctrlAction
+	// goroutine is the id of the goroutine executing the exclusive action, stall is closed once a send has waited
+	// behind it for reentrantCheckDelay, see sentByRunningTask
+	goroutine uint64
+	stallOnce sync.Once
+	stall     chan struct{}
+	// followUps are the follow-ups scheduled by the exclusive task, followUpsClosed is set once it has returned:
+	// both are guarded by followUpMutex, the task context possibly escaping the task, see ScheduleAfter
+	followUpMutex   sync.Mutex
+	followUps       []*ctrlAction
+	followUpsClosed bool
+}
+
+const (
+	actionQueued int32 = iota
+	actionStarted
+	actionCancelled
+)
+
+// reply sends the task outcome to the synchronous caller, at most once whatever the code path: the reply channel
+// is buffered for a single value, so a second send would block the handler loop forever.
+// The reply channel is never closed as it is pooled, a late send on it can never panic.
+// Should the reply channel have no room, reply gives up after timeout so that the handler loop is never stuck on a
+// caller which is not receiving. Returns false if the reply has been dropped.
+func (c *ctrlAction) reply(result interface{}, err error, timeout time.Duration) bool {
+	if !atomic.CompareAndSwapUint32(&c.replied, 0, 1) {
+		return true
+	}
+	reply := taskReply{result: result, err: err}
+	select {
+	case c.ctrlReplyChannel <- reply:
+		return true
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c.ctrlReplyChannel <- reply:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// replyChannelPool holds the buffered channels a synchronous send waits on for its reply.
+// A channel is only put back in the pool once its reply has been received: when the caller gives up waiting,
+// a late reply may still be sent on it, so it is left to the garbage collector.
+var replyChannelPool = sync.Pool{
+	New: func() interface{} {
+		return make(chan taskReply, 1)
+	},
 }
 
-// ThreadSafeActionHandler handles tasks to execute in a thread safe context
+// ThreadSafeActionHandler handles tasks to execute in a thread safe context.
+//
+// Tasks submitted from a single goroutine are executed in submission order (FIFO), whatever the mix of
+// synchronous and asynchronous sends: each send only returns once the handler loop has accepted the task.
+// No ordering is guaranteed between tasks submitted concurrently from different goroutines.
 type ThreadSafeActionHandler struct {
-	ctx         context.Context
+	name        string
 	ctrlChannel chan *ctrlAction
+	// life holds the *lifecycle of the current run of the handler loop, replaced by Restart
+	life atomic.Value
+	// readers counts the read tasks running concurrently with the handler loop, offloaded the offloaded tasks
+	readers   sync.WaitGroup
+	offloaded sync.WaitGroup
+	// queueSize is the ctrlChannel buffer size, queuePolicy applies to the asynchronous sends once it is full
+	queueSize   int
+	queuePolicy QueuePolicy
+	// scheduler holds the tasks taken off ctrlChannel to be executed in another order than FIFO, nil in FIFO order.
+	// The barriers and scheduledSeq are only used with a scheduler, from the handler loop goroutine.
+	order        Order
+	scheduler    Scheduler
+	barriers     []*pendingBarrier
+	scheduledSeq uint64
+
+	// closeMutex protects the lifecycle closed flag and the inflight increments so that no task is accepted once the
+	// shutdown started, and the lifecycle replacement
+	closeMutex sync.Mutex
+	// inflight and pending count the tasks submitted but neither executed nor rejected yet
+	inflight sync.WaitGroup
+	pending  int64
+	// executed and discarded count the user tasks executed and discarded since the handler creation, see
+	// ShutdownReport
+	executed  int64
+	discarded int64
+	// queued counts the submitted tasks not taken by the handler loop yet
+	queued int64
+	// syncWaiting counts the synchronous sends waiting for their reply, up to maxPending when set
+	syncWaiting int64
+	maxPending  int64
+	// maxQueued is the number of queued tasks from which the synchronous sends are shed, 0 to never shed them
+	maxQueued int64
+
+	slowTaskThreshold time.Duration
+	onSlowTask        func(duration time.Duration)
+	tracer            Tracer
+	metrics           MetricsCollector
+	latency           LatencyCollector
+	onPanic           func(id string, recovered interface{}, stack []byte)
+	middlewares       []Middleware
+	rateLimiter       *rateLimiter
+	taskTimeout       time.Duration
+	lockOSThread      bool
+	argCopy           func(args interface{}) (interface{}, error)
+	onDeadLetter      func(id string, task ThreadSafeTask, args interface{}, reason DiscardReason)
+	journal           Journal
+	journalSeq        uint64
+	coalescer         coalescer
+	queueBytes        queueBytes
+	breaker           CircuitBreaker
+	replyTimeout      time.Duration
+	// rollbacks are the rollbacks stored by SynchronousActionSendWithRollback, only accessed by the tasks
+	rollbacks []func()
+	// cache holds the results cached by SynchronousActionSendCached, only accessed by the tasks
+	cache map[string]cachedResult
+	// deferred are the follow-ups of the tasks dispatched by the current loop step, only accessed by the handler
+	// loop, see runDeferred
+	deferred []*ctrlAction
+	// autoRecover restarts the handler loop when it panics, see WithAutoRecover
+	autoRecover bool
+	// dispatching is the action being dispatched, only accessed by the handler loop
+	dispatching *ctrlAction
+	// running is the exclusive action executed, loopGoroutine the id of the handler loop goroutine: a task waiting
+	// for its own handler is detected with them, see sentByRunningTask
+	running       atomic.Value
+	loopGoroutine uint64
+	// step and stepped, when set by the tests, make the handler loop take the actions one by one, see stepper.go
+	step    chan struct{}
+	stepped chan struct{}
 }
 
-// NewThreadSafeActionHandler creates a new ThreadSafeActionHandler and start the handler loop
-func NewThreadSafeActionHandler(ctx context.Context) *ThreadSafeActionHandler {
-	handler := &ThreadSafeActionHandler{
-		ctx:         ctx,
-		ctrlChannel: make(chan *ctrlAction),
+// NewThreadSafeActionHandler creates a new ThreadSafeActionHandler configured with the given options
+// and start the handler loop. A nil ctx defaults to context.Background().
+func NewThreadSafeActionHandler(ctx context.Context, opts ...Option) *ThreadSafeActionHandler {
+	handler := &ThreadSafeActionHandler{replyTimeout: defaultReplyTimeout}
+	for _, opt := range opts {
+		opt(handler)
 	}
-	go handler.handlerLoop()
+	handler.ctrlChannel = make(chan *ctrlAction, handler.queueSize)
+	if handler.scheduler == nil {
+		handler.scheduler = newScheduler(handler.order)
+	}
+	life := newLifecycle(ctx)
+	handler.life.Store(life)
+	go handler.handlerLoop(life)
 	return handler
 }
 
-func (h *ThreadSafeActionHandler) handlerLoop() {
-	for {
+func (h *ThreadSafeActionHandler) handlerLoop(life *lifecycle) {
+	defer close(life.loopDone)
+	defer life.markClosed()
+	h.loopGoroutine = currentGoroutineID()
+	if h.lockOSThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	defer h.offloaded.Wait()
+	defer h.readers.Wait()
+	defer h.drainQueue()
+	for h.serve(life) {
+	}
+}
+
+// dispatch executes or discards an action taken by the handler loop
+func (h *ThreadSafeActionHandler) dispatch(ctrl *ctrlAction) {
+	h.dispatching = ctrl
+	h.dispatchAction(ctrl)
+	h.dispatching = nil
+}
+
+func (h *ThreadSafeActionHandler) dispatchAction(ctrl *ctrlAction) {
+	if err := h.admit(ctrl); err != nil {
+		h.discard(ctrl, err)
+		return
+	}
+	if ctrl.read {
+		h.readers.Add(1)
+		go func() {
+			defer h.readers.Done()
+			h.run(ctrl)
+		}()
+		return
+	}
+	if ctrl.offload {
+		h.offloaded.Add(1)
+		go func() {
+			defer h.offloaded.Done()
+			h.run(ctrl)
+		}()
+		return
+	}
+	// A task is exclusive: it waits for the read tasks already running
+	h.readers.Wait()
+	atomic.StoreUint64(&ctrl.goroutine, h.loopGoroutine)
+	h.running.Store(ctrl)
+	h.run(ctrl)
+	h.running.Store((*ctrlAction)(nil))
+	h.deferred = append(h.deferred, ctrl.closeFollowUps()...)
+}
+
+// run executes an accepted action and reports its outcome
+func (h *ThreadSafeActionHandler) run(ctrl *ctrlAction) {
+	start := time.Now()
+	result, err := h.executeWithTimeout(ctrl)
+	elapsed := time.Since(start)
+	h.observeLatency(ctrl, start, elapsed)
+	if panicErr, ok := err.(*taskPanic); ok && !ctrl.sync {
+		h.handleAsyncPanic(ctrl, panicErr)
+	}
+	h.recordClass(ctrl, err)
+	if err != nil && !ctrl.internal {
+		err = &ActionError{Name: h.name, ID: ctrl.id, Sync: ctrl.sync, Elapsed: elapsed, Err: err}
+	}
+	h.record(ctrl, result, err, elapsed)
+	if !ctrl.internal {
+		atomic.AddInt64(&h.executed, 1)
+	}
+	if ctrl.sync {
+		h.handleSyncReply(ctrl, err, result)
+	}
+	h.release(ctrl)
+	if ctrl.onDone != nil {
+		ctrl.onDone(taskReply{result: result, err: err}, true)
+	}
+	if h.metrics != nil && !ctrl.internal {
+		h.metrics.SetQueueDepth(int(atomic.LoadInt64(&h.pending)))
+	}
+}
+
+// taskKey is the context key marking the context given to the exclusive tasks of handler, see isReentrant. Its value
+// is the action of the task, see ScheduleAfter.
+type taskKey struct {
+	handler *ThreadSafeActionHandler
+}
+
+// isReentrant reports whether ctx is the context given to a task executed by the handler loop, or derives from it:
+// the caller is then the task itself, which cannot wait for its own handler without deadlocking
+func (h *ThreadSafeActionHandler) isReentrant(ctx context.Context) bool {
+	return ctx.Value(taskKey{handler: h}) != nil
+}
+
+// admit checks that an action accepted by the handler loop is still to be executed: a task whose call context is
+// already done, its deadline having expired while it was queued for instance, is skipped as its caller has given up.
+// Then it waits for the rate limiter, if any, to allow the execution of a user task, and marks the action as
+// started so that it cannot be cancelled anymore.
+// Returns an error when the handler context or the call context is done first, ErrTaskCancelled, or the error of
+// the args copy.
+func (h *ThreadSafeActionHandler) admit(ctrl *ctrlAction) error {
+	if ctrl.argsErr != nil {
+		return ctrl.argsErr
+	}
+	ctx := ctrl.ctrlThreadSafeCtx.ctx
+	if ctx.Err() != nil {
+		return h.callCtxErr(ctx)
+	}
+	if h.rateLimiter != nil && !ctrl.internal {
+		handlerCtx := h.handlerCtx()
 		select {
-		case <-h.ctx.Done():
-			return
-		case ctrl := <-h.ctrlChannel:
-			result, err := ctrl.ctrlThreadSafeCtx.execute()
-			if ctrl.sync {
-				h.handleSyncReply(ctrl, err, result)
-			}
+		case <-h.rateLimiter.wait():
+		case <-ctx.Done():
+			return h.callCtxErr(ctx)
+		case <-handlerCtx.Done():
+			return h.stoppedErr(handlerCtx.Err())
 		}
 	}
+	if !atomic.CompareAndSwapInt32(&ctrl.state, actionQueued, actionStarted) {
+		return ErrTaskCancelled
+	}
+	return nil
 }
 
-func (h *ThreadSafeActionHandler) handleSyncReply(ctrl *ctrlAction, err error, result interface{}) {
-	if err != nil {
-		if ctrl.ctrlErrorChannel != nil {
-			defer close(ctrl.ctrlErrorChannel)
-			ctrl.ctrlErrorChannel <- err
+// discard gives up an action accepted by the handler loop without executing it
+func (h *ThreadSafeActionHandler) discard(ctrl *ctrlAction, err error) {
+	if !ctrl.internal {
+		atomic.AddInt64(&h.discarded, 1)
+	}
+	if ctrl.sync {
+		h.handleSyncReply(ctrl, err, nil)
+	}
+	h.deadLetter(ctrl, err)
+	h.release(ctrl)
+	if ctrl.onDone != nil {
+		ctrl.onDone(taskReply{err: err}, false)
+	}
+}
+
+// Done returns a channel closed once the handler loop has exited, after the handler context is done or the
+// handler is shut down. Unlike the handler context, it is only closed once the last running task has returned.
+func (h *ThreadSafeActionHandler) Done() <-chan struct{} {
+	return h.current().loopDone
+}
+
+// executeWithTimeout executes the task, replying ErrActionTimeout to its synchronous caller if it runs longer than
+// the default task timeout. As a task cannot be interrupted, it keeps running in its own goroutine and the handler
+// loop waits for it to return before executing the next task: its late result is discarded.
+func (h *ThreadSafeActionHandler) executeWithTimeout(ctrl *ctrlAction) (interface{}, error) {
+	if h.taskTimeout <= 0 || ctrl.internal {
+		return h.execute(ctrl)
+	}
+	done := make(chan taskReply, 1)
+	go func() {
+		if !ctrl.read && !ctrl.offload {
+			atomic.StoreUint64(&ctrl.goroutine, currentGoroutineID())
+		}
+		result, err := h.execute(ctrl)
+		done <- taskReply{result: result, err: err}
+	}()
+	timer := time.NewTimer(h.taskTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-done:
+		return reply.result, reply.err
+	case <-timer.C:
+		if ctrl.sync {
+			h.handleSyncReply(ctrl, ErrActionTimeout, nil)
 		}
-	} else if ctrl.ctrlChannelReplies != nil {
-		defer close(ctrl.ctrlChannelReplies)
-		ctrl.ctrlChannelReplies <- result
 	}
+	reply := <-done
+	return reply.result, reply.err
 }
 
-func (h *ThreadSafeActionHandler) sendAction(action *ctrlAction) error {
+// Healthy reports whether the handler still executes tasks: it returns false once the handler context is done,
+// the handler is shut down, or the handler loop has exited.
+func (h *ThreadSafeActionHandler) Healthy() bool {
+	life := h.current()
 	select {
-	case <-h.ctx.Done():
-		return h.ctx.Err()
-	case h.ctrlChannel <- action:
+	case <-life.ctx.Done():
+		return false
+	case <-life.loopDone:
+		return false
+	default:
+		return true
 	}
+}
+
+func (h *ThreadSafeActionHandler) execute(ctrl *ctrlAction) (result interface{}, err error) {
+	ctx := ctrl.ctrlThreadSafeCtx.ctx
+	if ctrl.internal {
+		return ctrl.ctrlThreadSafeCtx.execute(ctx, nil)
+	}
+	if !ctrl.read && !ctrl.offload && ctrl.ctrlThreadSafeCtx.task == nil {
+		// Only the context-aware tasks receive ctx: it marks their sends to their own handler, see isReentrant
+		ctx = context.WithValue(ctx, taskKey{handler: h}, ctrl)
+	}
+	if h.tracer != nil {
+		var span Span
+		ctx, span = h.tracer.Start(ctx, TaskSpanName)
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+		}()
+	}
+	if h.onSlowTask == nil && h.metrics == nil {
+		return ctrl.ctrlThreadSafeCtx.execute(ctx, h.middlewares)
+	}
+	start := time.Now()
+	result, err = ctrl.ctrlThreadSafeCtx.execute(ctx, h.middlewares)
+	duration := time.Since(start)
+	if h.onSlowTask != nil && duration > h.slowTaskThreshold {
+		go h.onSlowTask(duration)
+	}
+	if h.metrics != nil {
+		h.metrics.ObserveTaskDuration(duration, err)
+	}
+	return result, err
+}
+
+// handleAsyncPanic reports the panic of an asynchronous task, which has no caller to propagate it to
+func (h *ThreadSafeActionHandler) handleAsyncPanic(ctrl *ctrlAction, panicErr *taskPanic) {
+	if h.onPanic == nil {
+		h.logTaskf(ctrl, "%v\n%s", panicErr, panicErr.stack)
+		return
+	}
+	go h.onPanic(ctrl.id, panicErr.value, panicErr.stack)
+}
+
+// handleSyncReply sends the task result to the caller. See ctrlAction.reply.
+func (h *ThreadSafeActionHandler) handleSyncReply(ctrl *ctrlAction, err error, result interface{}) {
+	if !ctrl.reply(result, err, h.replyTimeout) {
+		h.logTaskf(ctrl, "reply of a synchronous task dropped: the caller has not received it within %s", h.replyTimeout)
+	}
+}
+
+// logf logs a message prefixed with the handler name if any
+func (h *ThreadSafeActionHandler) logf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if h.name != "" {
+		message = fmt.Sprintf("thread-safe action handler %q: %s", h.name, message)
+	}
+	log.Print(message)
+}
+
+// stoppedErr returns the error reported when the handler does not execute tasks anymore
+func (h *ThreadSafeActionHandler) stoppedErr(err error) error {
+	return &HandlerError{Name: h.name, Err: err}
+}
+
+// callCtxErr returns the error of a done call context, reporting the handler as stopped if its context is done
+// as well: the call context of plain sends is the handler context itself
+func (h *ThreadSafeActionHandler) callCtxErr(ctx context.Context) error {
+	if err := h.handlerCtx().Err(); err != nil {
+		return h.stoppedErr(err)
+	}
+	return ctx.Err()
+}
+
+// acquire accounts a new task as in flight until the handler loop has executed it or its send is given up.
+// Returns an error matching ErrHandlerClosed once the handler is closed, or ErrHandlerStopped once its context is
+// done.
+func (h *ThreadSafeActionHandler) acquire() error {
+	h.closeMutex.Lock()
+	defer h.closeMutex.Unlock()
+	life := h.current()
+	if life.closed {
+		return h.stoppedErr(ErrHandlerClosed)
+	}
+	if err := life.ctx.Err(); err != nil {
+		return h.stoppedErr(err)
+	}
+	h.inflight.Add(1)
+	atomic.AddInt64(&h.pending, 1)
+	atomic.AddInt64(&h.queued, 1)
 	return nil
 }
 
+// release accounts an acquired task as executed or rejected, once
+func (h *ThreadSafeActionHandler) release(ctrl *ctrlAction) {
+	if !atomic.CompareAndSwapUint32(&ctrl.released, 0, 1) {
+		return
+	}
+	atomic.AddInt64(&h.pending, -1)
+	h.inflight.Done()
+}
+
+// dequeue accounts an acquired task as no longer queued
+func (h *ThreadSafeActionHandler) dequeue(ctrl *ctrlAction) {
+	atomic.AddInt64(&h.queued, -1)
+	h.releaseBytes(ctrl)
+}
+
+// releaseQueued accounts an acquired task as rejected before the handler loop has taken it
+func (h *ThreadSafeActionHandler) releaseQueued(ctrl *ctrlAction) {
+	h.dequeue(ctrl)
+	h.release(ctrl)
+}
+
+// discardQueued discards a task the handler loop has not taken, see discard
+func (h *ThreadSafeActionHandler) discardQueued(ctrl *ctrlAction, err error) {
+	h.dequeue(ctrl)
+	h.discard(ctrl, err)
+}
+
+// Len returns the number of tasks submitted but not started yet, the running tasks excluded
+func (h *ThreadSafeActionHandler) Len() int {
+	return int(atomic.LoadInt64(&h.queued))
+}
+
+// deliver sends an acquired action to the handler loop, giving up when ctx or the handler context is done.
+func (h *ThreadSafeActionHandler) deliver(ctx context.Context, action *ctrlAction) error {
+	var err error
+	handlerCtx := h.handlerCtx()
+	stalled := action.stallChannel()
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			err = h.callCtxErr(ctx)
+		case <-handlerCtx.Done():
+			err = h.stoppedErr(handlerCtx.Err())
+		case h.ctrlChannel <- action:
+			return nil
+		case <-stalled:
+			stalled = nil
+			if h.sentByRunningTask(action) {
+				err = ErrReentrantSend
+			}
+		}
+	}
+	h.deadLetter(action, err)
+	h.releaseQueued(action)
+	return err
+}
+
+// sendAction sends the action to the handler loop, giving up when ctx or the handler context is done.
+func (h *ThreadSafeActionHandler) sendAction(ctx context.Context, action *ctrlAction) error {
+	if err := h.acquire(); err != nil {
+		return err
+	}
+	if err := h.reserveBytes(ctx, action, QueueBlock); err != nil {
+		h.releaseQueued(action)
+		return err
+	}
+	return h.deliver(ctx, action)
+}
+
 // SynchronousActionSend sends an action to the thread-safe action handler in a synchronous way.
-// Returns the thread safe task result
+// Returns the thread safe task result, ErrNilTask if no task is provided, ErrReentrantSend when called from a task of
+// the same handler, ErrTooManyPending when the WithMaxPending limit is reached, or a HandlerError matching
+// ErrHandlerStopped when the handler context is done or the handler is closed.
+// A task waiting for its own handler would deadlock: a send still waiting behind the running task after a few
+// milliseconds checks whether it is made by this task, and gives up with ErrReentrantSend if so.
+// SynchronousActionSend never panics because of the task: a panicking task returns an error matching ErrTaskPanic
+// and carrying the recovered value, while the handler keeps running.
 func (h *ThreadSafeActionHandler) SynchronousActionSend(threadSafeTask ThreadSafeTask, args interface{}) (interface{}, error) {
-	chanDone := make(chan bool)
-	send := make(chan bool, 1)
-	replyChan := make(chan interface{}, 1)
-	errChan := make(chan error, 1)
-	defer func() {
-		close(chanDone)
-		close(send)
-	}()
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.sendSync(h.handlerCtx(), threadSafeTask, nil, args, false)
+}
+
+// SynchronousReadActionSend sends a read-only action to the thread-safe action handler in a synchronous way.
+// The task must not modify the state: consecutive read tasks are executed concurrently with each other, as under
+// a sync.RWMutex read lock, while the other tasks wait for them to return. As they do not run in the handler loop,
+// read tasks must not send tasks to their own handler.
+// See SynchronousActionSend.
+func (h *ThreadSafeActionHandler) SynchronousReadActionSend(threadSafeTask ThreadSafeTask, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.sendSync(h.handlerCtx(), threadSafeTask, nil, args, true)
+}
+
+// SynchronousReadActionSendCtx sends a read-only action to the thread-safe action handler in a synchronous way,
+// like SynchronousReadActionSend, giving up with the ctx error as soon as ctx is done like SynchronousActionSendCtx.
+func (h *ThreadSafeActionHandler) SynchronousReadActionSendCtx(ctx context.Context, threadSafeTask ThreadSafeTaskCtx, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.synchronousSend(ctx, threadSafeTask, args, true)
+}
+
+// SynchronousActionSendCtx sends an action to the thread-safe action handler in a synchronous way.
+// The task receives ctx, and the call gives up waiting with the ctx error as soon as ctx is done. A task still
+// queued once ctx is done is not executed.
+// Called by a task of the same handler with its context, or a context derived from it, it returns ErrReentrantSend
+// at once. See SynchronousActionSend.
+func (h *ThreadSafeActionHandler) SynchronousActionSendCtx(ctx context.Context, threadSafeTask ThreadSafeTaskCtx, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.synchronousSend(ctx, threadSafeTask, args, false)
+}
+
+// SynchronousActionSendCtxTimeout sends an action to the thread-safe action handler in a synchronous way, giving up
+// once ctx is done, once timeout has elapsed or once the handler is stopped, whichever comes first. The task receives
+// a child context of ctx done on the timeout as well.
+// Returns the ctx error when ctx is done first, an error matching context.DeadlineExceeded and mentioning the
+// timeout when it elapses first, or a HandlerError matching ErrHandlerStopped when the handler is stopped first.
+// See SynchronousActionSendCtx.
+func (h *ThreadSafeActionHandler) SynchronousActionSendCtxTimeout(ctx context.Context, timeout time.Duration,
+	threadSafeTask ThreadSafeTaskCtx, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := h.synchronousSend(callCtx, threadSafeTask, args, false)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("thread-safe task not completed within %v: %w", timeout, err)
+	}
+	return result, err
+}
+
+func (h *ThreadSafeActionHandler) synchronousSend(ctx context.Context, threadSafeTask ThreadSafeTaskCtx, args interface{}, read bool,
+	opts ...TaskOption) (interface{}, error) {
+	return h.sendSync(ctx, nil, threadSafeTask, args, read, opts...)
+}
+
+// sendSync sends a synchronous action executing task, or taskCtx with ctx if task is nil, and waits for its reply.
+// Setting task directly spares the allocation of its ThreadSafeTaskCtx adapter on the hot path.
+func (h *ThreadSafeActionHandler) sendSync(ctx context.Context, task ThreadSafeTask, taskCtx ThreadSafeTaskCtx,
+	args interface{}, read bool, opts ...TaskOption) (interface{}, error) {
+	if h.isReentrant(ctx) {
+		return nil, ErrReentrantSend
+	}
+	if h.maxPending > 0 {
+		defer atomic.AddInt64(&h.syncWaiting, -1)
+		if atomic.AddInt64(&h.syncWaiting, 1) > h.maxPending {
+			return nil, ErrTooManyPending
+		}
+	}
+	if h.maxQueued > 0 && atomic.LoadInt64(&h.queued) >= h.maxQueued {
+		return nil, ErrOverloaded
+	}
+	args, err := h.copyArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	replyChannel := replyChannelPool.Get().(chan taskReply)
 	ctrlAction := &ctrlAction{
 		sync: true,
+		read: read,
 		ctrlThreadSafeCtx: controlThreadSafeContext{
-			controlFunc: threadSafeTask,
+			ctx:         ctx,
+			task:        task,
+			controlFunc: taskCtx,
 			args:        args,
 		},
-		ctrlErrorChannel:   errChan,
-		ctrlChannelReplies: replyChan,
+		ctrlReplyChannel: replyChannel,
 	}
-	var err error
-	var reply interface{}
-	received := false
-	go func() {
-		for !received && err == nil {
-			select {
-			case <-h.ctx.Done():
-				err = h.ctx.Err()
-			case reply = <-replyChan:
-				received = true
-			case err = <-errChan:
-			case <-send:
-				err = h.sendAction(ctrlAction)
+	for _, opt := range opts {
+		opt(ctrlAction)
+	}
+	if !h.allowClass(ctrlAction) {
+		replyChannelPool.Put(replyChannel)
+		return nil, ErrCircuitOpen
+	}
+	h.stampEnqueue(ctrlAction)
+	ctrlAction.behind = h.runningTask()
+	if err := h.sendAction(ctx, ctrlAction); err != nil {
+		// The action never reached the handler loop: nothing can be sent on the channel anymore
+		replyChannelPool.Put(replyChannel)
+		return nil, err
+	}
+	// The reply channel is buffered: the handler loop never blocks on it once the caller has given up
+	handlerCtx := h.handlerCtx()
+	if ctrlAction.partial {
+		return h.awaitPartial(ctx, handlerCtx, ctrlAction)
+	}
+	stalled := ctrlAction.stallChannel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, h.callCtxErr(ctx)
+		case <-handlerCtx.Done():
+			return nil, h.stoppedErr(handlerCtx.Err())
+		case reply := <-replyChannel:
+			replyChannelPool.Put(replyChannel)
+			if reply.err != nil {
+				return nil, reply.err
+			}
+			return reply.result, nil
+		case <-stalled:
+			stalled = nil
+			// The action of the running task cannot have been started: it is skipped by the handler loop
+			if h.sentByRunningTask(ctrlAction) && atomic.CompareAndSwapInt32(&ctrlAction.state, actionQueued, actionCancelled) {
+				return nil, ErrReentrantSend
 			}
 		}
-		chanDone <- true
-	}()
-	send <- true
-	<-chanDone
-	return reply, err
+	}
 }
 
-// AsynchronousActionSend sends an action to the thread-safe action handler in an asynchronous way.
-func (h *ThreadSafeActionHandler) AsynchronousActionSend(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) {
+// newAsyncAction returns the action of an asynchronous send, executed with the handler context. When its args
+// cannot be copied, the action is discarded by the handler loop with the copy error.
+func (h *ThreadSafeActionHandler) newAsyncAction(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) *ctrlAction {
+	args, err := h.copyArgs(args)
 	action := &ctrlAction{
 		sync: false,
 		ctrlThreadSafeCtx: controlThreadSafeContext{
-			controlFunc: ctrlThreadSafeFunc,
-			args:        args,
+			ctx:  h.handlerCtx(),
+			task: ctrlThreadSafeFunc,
+			args: args,
 		},
+		argsErr: err,
 	}
-	_ = h.sendAction(action)
+	h.stampEnqueue(action)
+	return action
+}
+
+// stampEnqueue records the submission time of the action when its queue wait is observed
+func (h *ThreadSafeActionHandler) stampEnqueue(action *ctrlAction) {
+	if h.latency != nil {
+		action.enqueuedAt = time.Now()
+	}
+}
+
+// copyArgs returns the snapshot of args taken by the WithArgCopy function, if any, or its error
+func (h *ThreadSafeActionHandler) copyArgs(args interface{}) (interface{}, error) {
+	if h.argCopy == nil {
+		return args, nil
+	}
+	return h.argCopy(args)
+}
+
+// AsynchronousActionSend sends an action to the thread-safe action handler in an asynchronous way.
+// A nil task is ignored, as well as any task sent once the handler is closed.
+func (h *ThreadSafeActionHandler) AsynchronousActionSend(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) {
+	if ctrlThreadSafeFunc == nil {
+		return
+	}
+	action := h.newAsyncAction(ctrlThreadSafeFunc, args)
+	_ = h.sendAsyncAction(action)
+}
+
+// EnqueueAndReturn sends an action to the thread-safe action handler and returns once the handler has accepted it,
+// without waiting for its execution: the task is executed in order with the tasks submitted afterwards by the
+// caller, as with AsynchronousActionSend, but the submission error is returned. The task error is not reported.
+// Returns ErrNilTask if no task is provided, ErrQueueFull when rejected by the QueueDropNewest policy, or a
+// HandlerError matching ErrHandlerStopped when the handler context is done or the handler is closed.
+// Called from a task of the same handler with the QueueBlock policy, it deadlocks once the queue is full: the task
+// should schedule a follow-up with ScheduleAfter instead.
+func (h *ThreadSafeActionHandler) EnqueueAndReturn(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) error {
+	if ctrlThreadSafeFunc == nil {
+		return ErrNilTask
+	}
+	return h.sendAsyncAction(h.newAsyncAction(ctrlThreadSafeFunc, args))
+}
+
+// AsynchronousActionSendAck sends an action to the thread-safe action handler in an asynchronous way and returns a
+// delivery receipt: true is sent on the returned channel once the task has been executed, false if it has been
+// discarded because the handler context is done or the handler is closed. The channel is closed afterwards.
+// A nil task is discarded as well.
+func (h *ThreadSafeActionHandler) AsynchronousActionSendAck(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) <-chan bool {
+	ack := make(chan bool, 1)
+	if ctrlThreadSafeFunc == nil {
+		ack <- false
+		close(ack)
+		return ack
+	}
+	action := h.newAsyncAction(ctrlThreadSafeFunc, args)
+	action.onDone = func(_ taskReply, executed bool) {
+		ack <- executed
+		close(ack)
+	}
+	if err := h.sendAsyncAction(action); err != nil {
+		action.onDone(taskReply{err: err}, false)
+	}
+	return ack
+}
+
+// AsynchronousActionSendCallback sends an action to the thread-safe action handler in an asynchronous way and calls
+// onDone with the task result once it has been executed. If the task is discarded instead, because the handler
+// context is done or the handler is closed, onDone is called with a HandlerError matching ErrHandlerStopped.
+// onDone is called from its own goroutine so it never blocks the handler loop. A nil task is ignored.
+func (h *ThreadSafeActionHandler) AsynchronousActionSendCallback(ctrlThreadSafeFunc ThreadSafeTask, args interface{},
+	onDone func(result interface{}, err error)) {
+	if ctrlThreadSafeFunc == nil {
+		return
+	}
+	action := h.newAsyncAction(ctrlThreadSafeFunc, args)
+	if onDone != nil {
+		action.onDone = func(reply taskReply, _ bool) {
+			go onDone(reply.result, reply.err)
+		}
+	}
+	if err := h.sendAsyncAction(action); err != nil && onDone != nil {
+		action.onDone(taskReply{err: err}, false)
+	}
+}
+
+// CancelFunc cancels a task that has not been started yet. It reports whether the task has been cancelled, false
+// meaning the task has already been started or discarded. It is safe to call it several times.
+type CancelFunc func() bool
+
+// AsynchronousActionSendCancelable sends an action to the thread-safe action handler in an asynchronous way and
+// returns a function cancelling the task as long as the handler loop has not started it. A cancelled task is
+// skipped by the handler loop. A running task cannot be cancelled.
+// A nil task is ignored, as well as any task sent once the handler is closed: the returned function then reports
+// false.
+func (h *ThreadSafeActionHandler) AsynchronousActionSendCancelable(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) CancelFunc {
+	if ctrlThreadSafeFunc == nil {
+		return func() bool { return false }
+	}
+	action := h.newAsyncAction(ctrlThreadSafeFunc, args)
+	if err := h.sendAsyncAction(action); err != nil {
+		return func() bool { return false }
+	}
+	return func() bool {
+		return atomic.CompareAndSwapInt32(&action.state, actionQueued, actionCancelled) ||
+			atomic.LoadInt32(&action.state) == actionCancelled
+	}
+}
+
+// DetachedActionSend sends an action to the thread-safe action handler in an asynchronous way without ever blocking
+// the caller: the task is handed over to the handler loop from a dedicated goroutine.
+// The task is accounted as submitted before the call returns, so Shutdown waits for it to be executed. As it is
+// handed over later on, it is not ordered with the other tasks submitted by the caller.
+// A nil task is ignored, as well as any task sent once the handler is closed.
+func (h *ThreadSafeActionHandler) DetachedActionSend(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) {
+	if ctrlThreadSafeFunc == nil {
+		return
+	}
+	if handOver := h.acquireDetached(ctrlThreadSafeFunc, args); handOver != nil {
+		go handOver()
+	}
+}
+
+// acquireDetached accounts a detached task as submitted and returns the function handing it over to the handler
+// loop, nil if the task is rejected
+func (h *ThreadSafeActionHandler) acquireDetached(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) func() {
+	action := h.newAsyncAction(ctrlThreadSafeFunc, args)
+	if err := h.acquire(); err != nil {
+		return nil
+	}
+	return func() {
+		_ = h.deliver(h.handlerCtx(), action)
+	}
+}
+
+// Flush blocks until the handler has executed every task accepted before the call, whatever the tasks accepted
+// afterwards: a barrier task is sent to the handler loop and, as tasks are executed in order, the tasks accepted
+// before it have been executed once it is.
+// Returns ErrReentrantSend when ctx is the context of a task of the same handler, the ctx error if ctx is done
+// first, a HandlerError matching ErrHandlerStopped when the handler context is done or the handler is closed, or
+// ErrTaskDropped if the barrier has been evicted from the queue.
+func (h *ThreadSafeActionHandler) Flush(ctx context.Context) error {
+	if h.isReentrant(ctx) {
+		return ErrReentrantSend
+	}
+	// flushed receives nil once the barrier has been executed, or the reason it has been discarded
+	flushed := make(chan error, 1)
+	barrier := &ctrlAction{
+		internal: true,
+		ctrlThreadSafeCtx: controlThreadSafeContext{
+			ctx: ctx,
+			controlFunc: func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		},
+		onDone: func(reply taskReply, _ bool) {
+			flushed <- reply.err
+		},
+	}
+	if err := h.sendAction(ctx, barrier); err != nil {
+		return err
+	}
+	handlerCtx := h.handlerCtx()
+	select {
+	case <-ctx.Done():
+		return h.callCtxErr(ctx)
+	case <-handlerCtx.Done():
+		return h.stoppedErr(handlerCtx.Err())
+	case err := <-flushed:
+		return err
+	}
+}
+
+// WaitIdle blocks until the handler is idle: no task is queued nor running anymore, including the tasks accepted
+// after the call. Unlike Flush, it never returns while tasks keep being submitted.
+// Returns the same errors as Flush.
+func (h *ThreadSafeActionHandler) WaitIdle(ctx context.Context) error {
+	for {
+		if err := h.Flush(ctx); err != nil {
+			return err
+		}
+		if atomic.LoadInt64(&h.pending) == 0 {
+			return nil
+		}
+	}
+}
+
+var _ io.Closer = (*ThreadSafeActionHandler)(nil)
+
+// Close gracefully shuts the handler down, waiting for all the submitted tasks to be executed.
+// See Shutdown.
+func (h *ThreadSafeActionHandler) Close() error {
+	_, err := h.Shutdown(context.Background())
+	return err
+}
+
+// ShutdownReport tells what happened to the submitted tasks during a shutdown
+type ShutdownReport struct {
+	// Drained is the number of tasks executed during the shutdown
+	Drained int
+	// Discarded is the number of tasks discarded during the shutdown, including the tasks left unprocessed when the
+	// drain times out
+	Discarded int
+	// Duration is the time spent shutting down
+	Duration time.Duration
+}
+
+// Shutdown gracefully shuts the handler down: new tasks are rejected, the tasks already submitted are executed,
+// then the handler loop exits.
+// If ctx is done before the drain completes, Shutdown stops waiting and returns ErrDrainTimeout with the number
+// of tasks left unprocessed. Those tasks are discarded, except the running one which cannot be interrupted: the
+// handler loop exits once it returns.
+// Shutdown waits for the running task, so it must not be called from a thread-safe task.
+// Shutdown returns the report of the shutdown, the internal tasks such as the Flush barriers excluded.
+// It is safe to call Shutdown several times, subsequent calls return an empty report and nil immediately.
+func (h *ThreadSafeActionHandler) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	var report ShutdownReport
+	var err error
+	life := h.current()
+	life.closeOnce.Do(func() {
+		start := time.Now()
+		executed, discarded := atomic.LoadInt64(&h.executed), atomic.LoadInt64(&h.discarded)
+		h.closeMutex.Lock()
+		life.closed = true
+		h.closeMutex.Unlock()
+		life.startDraining()
+		defer life.cancel()
+		defer func() {
+			report.Drained += int(atomic.LoadInt64(&h.executed) - executed)
+			report.Discarded += int(atomic.LoadInt64(&h.discarded) - discarded)
+			report.Duration = time.Since(start)
+		}()
+
+		drained := make(chan struct{})
+		go func() {
+			h.inflight.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			unprocessed := atomic.LoadInt64(&h.pending)
+			report.Discarded = int(unprocessed)
+			err = fmt.Errorf("%w: %d tasks remain unprocessed", ErrDrainTimeout, unprocessed)
+		}
+	})
+	return report, err
 }
@@ -2,8 +2,12 @@ package action_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"runtime"
 	"testing"
+	"time"
 
 	"gotest.tools/assert"
 
@@ -94,7 +98,7 @@ func Test_ShouldExecuteActionFromASynchronousSendAnReturnError(t *testing.T) {
 	}
 	result, err := actionHandler.SynchronousActionSend(threadSafeFunc, nil)
 	assert.Equal(t, result, nil)
-	assert.Error(t, err, errMsg)
+	assert.ErrorContains(t, err, errMsg)
 }
 
 func Test_ShouldStopTaskExecutionWhenHandlerContextIsCancelledDuringSynchronousSend(t *testing.T) {
@@ -192,3 +196,1132 @@ func Test_ShouldDiscardSendForAllTheWaitingAsynchronousTaskIfTheContextIsCancele
 	actionHandler.AsynchronousActionSend(panicTask, nil)
 	done <- true
 }
+
+func Test_ShouldReturnErrorOnNilTaskForSynchronousSend(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	var actionHandler action.ThreadSafeActionHandlerIft = action.NewThreadSafeActionHandler(handlerCtx)
+
+	result, err := actionHandler.SynchronousActionSend(nil, nil)
+	assert.Equal(t, result, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+
+	// The handler must still be usable
+	result, err = actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 1234)
+}
+
+func Test_ShouldIgnoreNilTaskForAsynchronousSend(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	var actionHandler action.ThreadSafeActionHandlerIft = action.NewThreadSafeActionHandler(handlerCtx)
+
+	actionHandler.AsynchronousActionSend(nil, nil)
+
+	// The handler must still be usable
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+}
+
+func Test_ShouldWaitUntilAllSubmittedTasksAreExecuted(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	nbTasks := 100
+	executed := 0
+	incrementTask := func(args interface{}) (interface{}, error) {
+		executed++
+		return nil, nil
+	}
+	for i := 0; i < nbTasks; i++ {
+		actionHandler.AsynchronousActionSend(incrementTask, nil)
+	}
+
+	err := actionHandler.WaitIdle(context.TODO())
+	assert.NilError(t, err)
+	assert.Equal(t, executed, nbTasks)
+}
+
+func Test_ShouldStopWaitingIdleWhenContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	done := make(chan bool)
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+
+	waitCtx, cancelWait := context.WithCancel(context.TODO())
+	cancelWait()
+	err := actionHandler.WaitIdle(waitCtx)
+	assert.Error(t, err, "context canceled")
+	done <- true
+}
+
+func Test_ShouldExecuteTasksInSubmissionOrderForASingleProducer(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	nbTasks := 1000
+	var executionOrder []int
+	appendTask := func(args interface{}) (interface{}, error) {
+		executionOrder = append(executionOrder, args.(int))
+		return nil, nil
+	}
+	for i := 0; i < nbTasks; i++ {
+		if i%10 == 0 {
+			_, err := actionHandler.SynchronousActionSend(appendTask, i)
+			assert.NilError(t, err)
+		} else {
+			actionHandler.AsynchronousActionSend(appendTask, i)
+		}
+	}
+
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, len(executionOrder), nbTasks)
+	for i := 1; i < nbTasks; i++ {
+		assert.Assert(t, executionOrder[i-1] < executionOrder[i], "task %d executed after task %d", executionOrder[i-1], executionOrder[i])
+	}
+}
+
+// waitForGoroutineCount waits for the number of goroutines to settle down to the expected maximum
+func waitForGoroutineCount(t *testing.T, maxExpected int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > maxExpected && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Assert(t, runtime.NumGoroutine() <= maxExpected, "%d goroutines still running, expected at most %d",
+		runtime.NumGoroutine(), maxExpected)
+}
+
+// waitForPendingTasks waits for the expected number of tasks to be submitted to the handler
+func waitForPendingTasks(t *testing.T, actionHandler *action.ThreadSafeActionHandler, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for action.PendingTasks(actionHandler) != expected && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, action.PendingTasks(actionHandler), expected)
+}
+
+func Test_ShouldNotLeakGoroutinesWhenContextIsCancelledDuringSynchronousSends(t *testing.T) {
+	nbGoroutinesBefore := runtime.NumGoroutine()
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	done := make(chan bool)
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+
+	nbConc := 100
+	allCanceled := make(chan error, nbConc)
+	doNothingTask := func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	for i := 0; i < nbConc; i++ {
+		go func() {
+			// Those sends are blocked until the context is cancelled
+			_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+			allCanceled <- err
+		}()
+	}
+	cancelHandler()
+	for i := 0; i < nbConc; i++ {
+		assert.Error(t, <-allCanceled, "context canceled")
+	}
+	// Sends after the cancellation must not leak either
+	for i := 0; i < nbConc; i++ {
+		_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+		assert.Error(t, err, "context canceled")
+	}
+	close(done)
+
+	waitForGoroutineCount(t, nbGoroutinesBefore)
+}
+
+func Test_ShouldExecuteAlreadySubmittedTasksOnClose(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+
+	nbTasks := 100
+	executed := make(chan bool, nbTasks)
+	for i := 0; i < nbTasks; i++ {
+		go actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+			executed <- true
+			return nil, nil
+		}, nil)
+	}
+	// Make sure the first task is submitted before closing
+	<-executed
+
+	assert.NilError(t, actionHandler.Close())
+	_, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerClosed))
+}
+
+func Test_ShouldWaitForTheRunningTaskOnClose(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	done := make(chan bool)
+	hasBeenCalled := make(chan bool)
+	taskFinished := false
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		taskFinished = true
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+
+	closed := make(chan error)
+	go func() {
+		closed <- actionHandler.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the running task")
+	case <-time.After(20 * time.Millisecond):
+	}
+	done <- true
+	assert.NilError(t, <-closed)
+	assert.Assert(t, taskFinished)
+}
+
+func Test_ShouldRejectSendsOnceClosed(t *testing.T) {
+	var actionHandler action.ThreadSafeActionHandlerIft = action.NewThreadSafeActionHandler(context.TODO())
+	closer := actionHandler.(io.Closer)
+	assert.NilError(t, closer.Close())
+
+	panicTask := func(args interface{}) (interface{}, error) {
+		panic("Should not be triggered")
+	}
+	result, err := actionHandler.SynchronousActionSend(panicTask, nil)
+	assert.Equal(t, result, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerClosed))
+	// This task should be discarded and return immediately
+	actionHandler.AsynchronousActionSend(panicTask, nil)
+}
+
+func Test_ShouldBeAbleToCloseSeveralTimes(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+
+	assert.NilError(t, actionHandler.Close())
+	assert.NilError(t, actionHandler.Close())
+	assert.Assert(t, errors.Is(actionHandler.WaitIdle(context.TODO()), action.ErrHandlerClosed))
+}
+
+func Test_ShouldStopWaitingForAStuckTaskOnShutdownTimeout(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	done := make(chan bool)
+	defer close(done)
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+	// Those tasks are queued behind the stuck one
+	nbQueued := 3
+	for i := 0; i < nbQueued; i++ {
+		go actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+			return nil, nil
+		}, nil)
+	}
+	waitForPendingTasks(t, actionHandler, nbQueued+1)
+
+	timeout := 20 * time.Millisecond
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.TODO(), timeout)
+	defer cancelShutdown()
+	start := time.Now()
+	report, err := actionHandler.Shutdown(shutdownCtx)
+	assert.Assert(t, errors.Is(err, action.ErrDrainTimeout))
+	assert.ErrorContains(t, err, fmt.Sprintf("%d tasks remain unprocessed", nbQueued+1))
+	assert.Assert(t, time.Since(start) < timeout+time.Second)
+	assert.Equal(t, report.Drained, 0)
+	assert.Equal(t, report.Discarded, nbQueued+1)
+	// Subsequent calls do not wait anymore
+	report, err = actionHandler.Shutdown(context.TODO())
+	assert.NilError(t, err)
+	assert.Equal(t, report, action.ShutdownReport{})
+}
+
+func Test_ShouldReportTheTasksDrainedOnShutdown(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO(), action.WithQueueSize(10))
+	release := blockHandler(actionHandler)
+	nbSubmitted := 5
+	executed := 0
+	for i := 0; i < nbSubmitted; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	cancelled := actionHandler.AsynchronousActionSendCancelable(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, cancelled())
+
+	type shutdownResult struct {
+		report action.ShutdownReport
+		err    error
+	}
+	shutdown := make(chan shutdownResult)
+	go func() {
+		report, err := actionHandler.Shutdown(context.TODO())
+		shutdown <- shutdownResult{report: report, err: err}
+	}()
+	// Release the handler once the shutdown has started, new tasks being rejected
+	noop := func(interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	nbAccepted := 0
+	for actionHandler.EnqueueAndReturn(noop, nil) == nil {
+		nbAccepted++
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	result := <-shutdown
+	report := result.report
+	assert.NilError(t, result.err)
+	// The blocking task is drained along with the submitted ones, including the ones accepted before the closing
+	assert.Equal(t, report.Drained, nbSubmitted+1+nbAccepted)
+	assert.Equal(t, report.Discarded, 1)
+	assert.Assert(t, report.Duration > 0)
+	assert.Equal(t, executed, nbSubmitted)
+}
+
+func Test_ShouldCloseDoneOnceTheHandlerLoopHasExited(t *testing.T) {
+	nbGoroutinesBefore := runtime.NumGoroutine()
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	done := make(chan bool)
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+
+	cancelHandler()
+	// The loop is still running the task
+	select {
+	case <-actionHandler.Done():
+		t.Fatal("Done closed while a task is running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	done <- true
+	select {
+	case <-actionHandler.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed after the context cancellation")
+	}
+	waitForGoroutineCount(t, nbGoroutinesBefore)
+}
+
+func Test_ShouldCloseDoneOnShutdown(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	assert.NilError(t, actionHandler.Close())
+	select {
+	case <-actionHandler.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed after the shutdown")
+	}
+}
+
+type tenantKey struct{}
+
+func Test_ShouldPassTheCallContextToTheTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	callCtx := context.WithValue(context.TODO(), tenantKey{}, "tenant-1")
+	result, err := actionHandler.SynchronousActionSendCtx(callCtx, func(ctx context.Context, args interface{}) (interface{}, error) {
+		return fmt.Sprintf("%v/%v", ctx.Value(tenantKey{}), args), nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "tenant-1/1234")
+}
+
+func Test_ShouldPassTheCallContextToTheReadTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	callCtx := context.WithValue(context.TODO(), tenantKey{}, "tenant-1")
+	result, err := actionHandler.SynchronousReadActionSendCtx(callCtx, func(ctx context.Context, args interface{}) (interface{}, error) {
+		return fmt.Sprintf("%v/%v", ctx.Value(tenantKey{}), args), nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "tenant-1/1234")
+
+	// A read task still queued once its context is done is not executed
+	release := blockHandler(actionHandler)
+	cancelledCtx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	executed := false
+	_, err = actionHandler.SynchronousReadActionSendCtx(cancelledCtx, func(context.Context, interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}, nil)
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, !executed)
+	_, err = actionHandler.SynchronousReadActionSendCtx(context.TODO(), nil, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+}
+
+func Test_ShouldStopWaitingWhenTheCallContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	done := make(chan bool)
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+
+	callCtx, cancelCall := context.WithCancel(context.TODO())
+	cancelled := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendCtx(callCtx, func(ctx context.Context, args interface{}) (interface{}, error) {
+			return nil, nil
+		}, nil)
+		cancelled <- err
+	}()
+	cancelCall()
+	assert.Error(t, <-cancelled, "context canceled")
+	done <- true
+
+	// The handler must still be usable
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+	_, err = actionHandler.SynchronousActionSendCtx(context.TODO(), nil, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+}
+
+func Benchmark_SynchronousActionSend(b *testing.B) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	doNothingTask := func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = actionHandler.SynchronousActionSend(doNothingTask, nil)
+	}
+}
+
+func Benchmark_SynchronousActionSend_Parallel(b *testing.B) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	counter := 0
+	incrementTask := func(args interface{}) (interface{}, error) {
+		counter++
+		return counter, nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = actionHandler.SynchronousActionSend(incrementTask, nil)
+		}
+	})
+}
+
+func Test_ShouldNotMixUpRepliesOfConcurrentSynchronousSends(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	echoTask := func(ctx context.Context, args interface{}) (interface{}, error) {
+		if args.(int)%3 == 0 {
+			return nil, fmt.Errorf("error %d", args)
+		}
+		return args, nil
+	}
+
+	type outcome struct {
+		args   int
+		result interface{}
+		err    error
+	}
+	nbConc := 100
+	nbSends := 100
+	outcomes := make(chan outcome, nbConc*nbSends)
+	for i := 0; i < nbConc; i++ {
+		go func(i int) {
+			for j := 0; j < nbSends; j++ {
+				args := i*nbSends + j
+				callCtx, cancelCall := context.WithCancel(context.TODO())
+				if j%5 == 0 {
+					// Give up waiting: the late reply must not reach another caller
+					cancelCall()
+				}
+				result, err := actionHandler.SynchronousActionSendCtx(callCtx, echoTask, args)
+				cancelCall()
+				outcomes <- outcome{args: args, result: result, err: err}
+			}
+		}(i)
+	}
+	for i := 0; i < nbConc*nbSends; i++ {
+		sent := <-outcomes
+		switch {
+		case sent.err == context.Canceled:
+		case sent.args%3 == 0:
+			assert.ErrorContains(t, sent.err, fmt.Sprintf("error %d", sent.args))
+		default:
+			assert.NilError(t, sent.err)
+			assert.Equal(t, sent.result, sent.args)
+		}
+	}
+}
+
+func Test_ShouldAlwaysUnblockSynchronousSendsOfTasksReturningNothing(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	nilTask := func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	nbConc := 100
+	nbSends := 100
+	allDone := make(chan bool, nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func() {
+			for j := 0; j < nbSends; j++ {
+				result, err := actionHandler.SynchronousActionSend(nilTask, nil)
+				assert.NilError(t, err)
+				assert.Equal(t, result, nil)
+			}
+			allDone <- true
+		}()
+	}
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < nbConc; i++ {
+		select {
+		case <-allDone:
+		case <-timeout:
+			t.Fatalf("%d goroutines still blocked on a synchronous send", nbConc-i)
+		}
+	}
+}
+
+func Test_ShouldReturnImmediatelyFromADetachedSendWhileTheHandlerIsBusy(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+
+	executed := make(chan interface{}, 1)
+	returned := make(chan struct{})
+	go func() {
+		actionHandler.DetachedActionSend(func(args interface{}) (interface{}, error) {
+			executed <- args
+			return nil, nil
+		}, 42)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("the detached send should not wait for the busy handler loop")
+	}
+
+	close(release)
+	select {
+	case args := <-executed:
+		assert.Equal(t, args, 42)
+	case <-time.After(time.Second):
+		t.Fatal("the detached task should eventually be executed")
+	}
+}
+
+func Test_ShouldWaitForDetachedTasksOnClose(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	release := make(chan struct{})
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		<-release
+		return nil, nil
+	}, nil)
+	executed := 0
+	for i := 0; i < 10; i++ {
+		actionHandler.DetachedActionSend(func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	close(release)
+
+	assert.NilError(t, actionHandler.Close())
+	assert.Equal(t, executed, 10)
+	actionHandler.DetachedActionSend(func(interface{}) (interface{}, error) {
+		executed++
+		return nil, nil
+	}, nil)
+	assert.Equal(t, executed, 10)
+}
+
+func Test_ShouldAcknowledgeAnExecutedAsynchronousTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	executed := false
+	ack := actionHandler.AsynchronousActionSendAck(func(interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}, nil)
+	assert.Assert(t, <-ack)
+	assert.Assert(t, executed)
+	_, open := <-ack
+	assert.Assert(t, !open)
+}
+
+func Test_ShouldReportADiscardedAsynchronousTaskWhenTheContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+
+	acks := make(chan (<-chan bool))
+	go func() {
+		acks <- actionHandler.AsynchronousActionSendAck(func(interface{}) (interface{}, error) {
+			return nil, nil
+		}, nil)
+	}()
+	waitForPendingTasks(t, actionHandler, 2)
+	cancelHandler()
+	assert.Assert(t, !<-<-acks)
+}
+
+func Test_ShouldReportADiscardedAsynchronousTaskOnceClosed(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	assert.NilError(t, actionHandler.Close())
+
+	ack := actionHandler.AsynchronousActionSendAck(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, !<-ack)
+	assert.Assert(t, !<-actionHandler.AsynchronousActionSendAck(nil, nil))
+}
+
+func Test_ShouldRejectASynchronousSendFromATaskOfTheSameHandler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	result, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return actionHandler.SynchronousActionSendCtx(ctx, func(context.Context, interface{}) (interface{}, error) {
+			return "nested", nil
+		}, nil)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrReentrantSend))
+	assert.Equal(t, result, nil)
+
+	// The contexts derived from the task context are detected as well
+	_, err = actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		return nil, actionHandler.WaitIdle(waitCtx)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrReentrantSend))
+}
+
+func Test_ShouldRejectASynchronousSendFromAPlainTaskOfTheSameHandler(t *testing.T) {
+	for _, testCase := range []struct {
+		name string
+		opts []action.Option
+	}{
+		{name: "queue size 0"},
+		{name: "queue size 8", opts: []action.Option{action.WithQueueSize(8)}},
+		{name: "task timeout", opts: []action.Option{action.WithDefaultTaskTimeout(time.Minute)}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+			defer cancelHandler()
+			actionHandler := action.NewThreadSafeActionHandler(handlerCtx, testCase.opts...)
+
+			var executed []interface{}
+			result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+				return actionHandler.SynchronousActionSend(recordTask(&executed), "nested")
+			}, nil)
+			assert.Assert(t, errors.Is(err, action.ErrReentrantSend))
+			assert.Equal(t, result, nil)
+
+			// The nested task is skipped and the handler keeps executing the tasks
+			_, err = actionHandler.SynchronousActionSend(recordTask(&executed), "next")
+			assert.NilError(t, err)
+			assert.DeepEqual(t, executed, []interface{}{"next"})
+		})
+	}
+}
+
+func Test_ShouldWaitForALongTaskWhenSentFromAnotherGoroutine(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	go func() {
+		_, _ = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		}, nil)
+	}()
+	<-started
+	// The send stalls behind the running task without being made by it
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return "done", nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "done")
+}
+
+func Test_ShouldAllowASynchronousSendFromATaskOfAnotherHandler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	otherHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return otherHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+			return "nested", nil
+		}, nil)
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "nested")
+}
+
+// expiringContext is a call context whose deadline expires once expired is closed. Its Done channel never fires:
+// the send keeps waiting for the handler loop, as a task queued behind a backlog would.
+type expiringContext struct {
+	context.Context
+	expired chan struct{}
+}
+
+func (c expiringContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c expiringContext) Err() error {
+	select {
+	case <-c.expired:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+func Test_ShouldSkipAQueuedTaskWhoseDeadlineHasExpired(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+
+	callCtx := expiringContext{Context: context.TODO(), expired: make(chan struct{})}
+	executed := false
+	errChan := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendCtx(callCtx, func(context.Context, interface{}) (interface{}, error) {
+			executed = true
+			return nil, nil
+		}, nil)
+		errChan <- err
+	}()
+	// Queue the task behind the slow one, then let its deadline expire before it can run
+	waitForPendingTasks(t, actionHandler, 2)
+	close(callCtx.expired)
+	close(release)
+
+	assert.Equal(t, <-errChan, context.DeadlineExceeded)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, !executed)
+}
+
+func Test_ShouldReplyAtMostOnceWhenCallersGiveUpDuringTheReply(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	echoTask := func(_ context.Context, args interface{}) (interface{}, error) {
+		return args, nil
+	}
+
+	nbConc := 50
+	nbSends := 200
+	allDone := make(chan bool, nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func(producer int) {
+			defer func() { allDone <- true }()
+			for j := 0; j < nbSends; j++ {
+				// Give up at any stage of the send: before the delivery, during the execution or during the reply
+				callCtx, cancelCall := context.WithTimeout(context.TODO(), time.Duration(j%20)*time.Microsecond)
+				args := producer*nbSends + j
+				result, err := actionHandler.SynchronousActionSendCtx(callCtx, echoTask, args)
+				cancelCall()
+				if err != nil {
+					assert.Equal(t, err, context.DeadlineExceeded)
+					continue
+				}
+				// A reply left on a given up channel must never reach another caller
+				assert.Equal(t, result, args)
+			}
+		}(i)
+	}
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < nbConc; i++ {
+		select {
+		case <-allDone:
+		case <-timeout:
+			t.Fatalf("%d goroutines still blocked on a synchronous send", nbConc-i)
+		}
+	}
+
+	result, err := actionHandler.SynchronousActionSendCtx(context.TODO(), echoTask, "still running")
+	assert.NilError(t, err)
+	assert.Equal(t, result, "still running")
+}
+
+type callbackOutcome struct {
+	result interface{}
+	err    error
+}
+
+func Test_ShouldCallBackWithTheResultOfAnAsynchronousTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	taskErr := errors.New("task error")
+
+	outcomes := make(chan callbackOutcome, 2)
+	onDone := func(result interface{}, err error) {
+		outcomes <- callbackOutcome{result: result, err: err}
+	}
+	actionHandler.AsynchronousActionSendCallback(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, 42, onDone)
+	outcome := <-outcomes
+	assert.NilError(t, outcome.err)
+	assert.Equal(t, outcome.result, 42)
+
+	actionHandler.AsynchronousActionSendCallback(func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, nil, onDone)
+	outcome = <-outcomes
+	assert.Assert(t, errors.Is(outcome.err, taskErr))
+	assert.Equal(t, outcome.result, nil)
+}
+
+func Test_ShouldCallBackWithHandlerStoppedWhenTheTaskIsDiscarded(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+
+	outcomes := make(chan callbackOutcome, 1)
+	executed := false
+	go actionHandler.AsynchronousActionSendCallback(func(interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}, nil, func(result interface{}, err error) {
+		outcomes <- callbackOutcome{result: result, err: err}
+	})
+	waitForPendingTasks(t, actionHandler, 2)
+	cancelHandler()
+
+	outcome := <-outcomes
+	assert.Assert(t, errors.Is(outcome.err, action.ErrHandlerStopped))
+	assert.Assert(t, !executed)
+
+	// Once closed, the task is discarded immediately
+	closedHandler := action.NewThreadSafeActionHandler(context.TODO())
+	assert.NilError(t, closedHandler.Close())
+	closedHandler.AsynchronousActionSendCallback(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil, func(result interface{}, err error) {
+		outcomes <- callbackOutcome{result: result, err: err}
+	})
+	outcome = <-outcomes
+	assert.Assert(t, errors.Is(outcome.err, action.ErrHandlerClosed))
+	assert.Assert(t, errors.Is(outcome.err, action.ErrHandlerStopped))
+}
+
+func Test_ShouldFlushTheTasksSubmittedBeforeTheCall(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	executed := 0
+	for i := 0; i < 10; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	assert.NilError(t, actionHandler.Flush(context.TODO()))
+	assert.Equal(t, executed, 10)
+}
+
+func Test_ShouldNotWaitForTheTasksSubmittedAfterTheFlush(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(10))
+	release := blockHandler(actionHandler)
+
+	executed := 0
+	for i := 0; i < 3; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	flushed := make(chan error)
+	go func() {
+		flushed <- actionHandler.Flush(context.TODO())
+	}()
+	waitForPendingTasks(t, actionHandler, 5)
+	// Submitted after the flush barrier, this task keeps the handler busy
+	releaseLate := make(chan struct{})
+	defer close(releaseLate)
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		<-releaseLate
+		return nil, nil
+	}, nil)
+	release()
+
+	assert.NilError(t, <-flushed)
+	assert.Equal(t, executed, 3)
+	idleCtx, cancelIdle := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+	defer cancelIdle()
+	assert.Equal(t, actionHandler.WaitIdle(idleCtx), context.DeadlineExceeded)
+}
+
+func Test_ShouldNeverExecuteACancelledTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(1))
+	release := blockHandler(actionHandler)
+
+	executed := false
+	cancelTask := actionHandler.AsynchronousActionSendCancelable(func(interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}, nil)
+	assert.Assert(t, cancelTask())
+	assert.Assert(t, cancelTask())
+	release()
+
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, !executed)
+	assert.Equal(t, action.PendingTasks(actionHandler), 0)
+}
+
+func Test_ShouldNotCancelAStartedTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cancelTask := actionHandler.AsynchronousActionSendCancelable(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+	assert.Assert(t, !cancelTask())
+	close(release)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	assert.NilError(t, actionHandler.Close())
+	assert.Assert(t, !actionHandler.AsynchronousActionSendCancelable(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)())
+}
+
+func Test_ShouldReportTheHandlerAsUnhealthyOnceStopped(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	assert.Assert(t, actionHandler.Healthy())
+
+	cancelHandler()
+	assert.Assert(t, !actionHandler.Healthy())
+	<-actionHandler.Done()
+	assert.Assert(t, !actionHandler.Healthy())
+
+	closedHandler := action.NewThreadSafeActionHandler(context.TODO())
+	assert.Assert(t, closedHandler.Healthy())
+	assert.NilError(t, closedHandler.Close())
+	assert.Assert(t, !closedHandler.Healthy())
+}
+
+func Test_ShouldWrapTaskErrorsWithTheirExecutionContext(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithName("subscriptions"))
+	taskErr := errors.New("task error")
+
+	_, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		return nil, fmt.Errorf("wrapped by the task: %w", taskErr)
+	}, nil)
+	assert.Assert(t, errors.Is(err, taskErr))
+	var actionErr *action.ActionError
+	assert.Assert(t, errors.As(err, &actionErr))
+	assert.Equal(t, actionErr.Name, "subscriptions")
+	assert.Assert(t, actionErr.Sync)
+	assert.Assert(t, actionErr.Elapsed >= 5*time.Millisecond)
+	assert.ErrorContains(t, err, `thread-safe action handler "subscriptions": synchronous task failed after`)
+	assert.ErrorContains(t, err, "wrapped by the task: task error")
+
+	asyncErr := make(chan error, 1)
+	actionHandler.AsynchronousActionSendCallback(func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, nil, func(_ interface{}, err error) {
+		asyncErr <- err
+	})
+	err = <-asyncErr
+	assert.Assert(t, errors.Is(err, taskErr))
+	assert.Assert(t, errors.As(err, &actionErr))
+	assert.Assert(t, !actionErr.Sync)
+
+	// The errors of the handler itself are not task errors
+	assert.NilError(t, actionHandler.Close())
+	_, err = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, !errors.As(err, &actionErr))
+}
+
+func Test_ShouldDefaultANilContextToTheBackgroundContext(t *testing.T) {
+	// A nil context is handled on purpose
+	actionHandler := action.NewThreadSafeActionHandler(nil)
+	defer actionHandler.Close()
+
+	result, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, "executed")
+	assert.NilError(t, err)
+	assert.Equal(t, result, "executed")
+	assert.Assert(t, actionHandler.Healthy())
+}
+
+func Test_ShouldReturnWhicheverOfTheCallContextTheTimeoutOrTheHandlerStopsTheSendFirst(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	release := blockHandler(actionHandler)
+	defer release()
+	noop := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	// The timeout elapses first while the handler loop is busy
+	_, err := actionHandler.SynchronousActionSendCtxTimeout(context.TODO(), 10*time.Millisecond, noop, nil)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	assert.ErrorContains(t, err, "not completed within 10ms")
+
+	// The call context is done first
+	callCtx, cancelCall := context.WithCancel(context.TODO())
+	cancelled := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendCtxTimeout(callCtx, time.Minute, noop, nil)
+		cancelled <- err
+	}()
+	cancelCall()
+	assert.Equal(t, <-cancelled, context.Canceled)
+
+	// The handler is stopped first
+	stopped := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendCtxTimeout(context.TODO(), time.Minute, noop, nil)
+		stopped <- err
+	}()
+	cancelHandler()
+	assert.Assert(t, errors.Is(<-stopped, action.ErrHandlerStopped))
+}
+
+func Test_ShouldExecuteATaskCompletedWithinTheTimeout(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	callCtx := context.WithValue(context.TODO(), tenantKey{}, "tenant-1")
+	result, err := actionHandler.SynchronousActionSendCtxTimeout(callCtx, time.Minute, func(ctx context.Context, args interface{}) (interface{}, error) {
+		_, hasDeadline := ctx.Deadline()
+		return fmt.Sprintf("%v/%v/%v", ctx.Value(tenantKey{}), args, hasDeadline), nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "tenant-1/1234/true")
+	_, err = actionHandler.SynchronousActionSendCtxTimeout(context.TODO(), time.Minute, nil, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+}
@@ -0,0 +1,118 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// InlineActionHandler is a ThreadSafeActionHandlerIft executing the tasks immediately in the caller goroutine,
+// without handler loop. It is meant to be injected in the unit tests of code depending on
+// ThreadSafeActionHandlerIft: no context setup is needed and a task has been executed once its send returns,
+// asynchronous sends included.
+// The tasks are still executed one at a time, and their errors and panics are reported as by
+// ThreadSafeActionHandler. As with ThreadSafeActionHandler, the asynchronous tasks sent by a task are executed once
+// it has returned: their send returns before.
+// Unlike ThreadSafeActionHandler, the sends made by another goroutine while a task is executed are handled as if
+// made by this task: a synchronous one returns ErrReentrantSend, an asynchronous one is executed once the task has
+// returned.
+type InlineActionHandler struct {
+	// mutex guards executing, set while a task is executed, and pending, the asynchronous tasks sent meanwhile. It is
+	// not held while a task is executed, so that the task sends are detected instead of deadlocking.
+	mutex     sync.Mutex
+	executing bool
+	pending   []inlineTask
+	// reporter holds the options reporting the panics of the asynchronous tasks, it never executes tasks
+	reporter *ThreadSafeActionHandler
+}
+
+// inlineTask is an asynchronous task sent while a task of an InlineActionHandler is executed
+type inlineTask struct {
+	task ThreadSafeTask
+	args interface{}
+}
+
+var _ ThreadSafeActionHandlerIft = (*InlineActionHandler)(nil)
+
+// NewInlineActionHandler creates a new InlineActionHandler. Only the options reporting the panics of the
+// asynchronous tasks apply, such as WithPanicHandler and WithName: the other ones are ignored.
+func NewInlineActionHandler(opts ...Option) *InlineActionHandler {
+	reporter := &ThreadSafeActionHandler{}
+	for _, opt := range opts {
+		opt(reporter)
+	}
+	return &InlineActionHandler{reporter: reporter}
+}
+
+// SynchronousActionSend executes the task in the caller goroutine and returns its result.
+// Returns ErrNilTask if no task is provided, or ErrReentrantSend when called while a task is executed.
+func (h *InlineActionHandler) SynchronousActionSend(threadSafeTask ThreadSafeTask, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	if !h.enter(threadSafeTask, args, true) {
+		return nil, ErrReentrantSend
+	}
+	defer h.leave()
+	return h.run(threadSafeTask, args, true)
+}
+
+// AsynchronousActionSend executes the task in the caller goroutine, reporting its panic if any like
+// ThreadSafeActionHandler, see WithPanicHandler. A nil task is ignored.
+func (h *InlineActionHandler) AsynchronousActionSend(ctrlThreadSafeFunc ThreadSafeTask, args interface{}) {
+	if ctrlThreadSafeFunc == nil {
+		return
+	}
+	if !h.enter(ctrlThreadSafeFunc, args, false) {
+		return
+	}
+	defer h.leave()
+	_, _ = h.run(ctrlThreadSafeFunc, args, false)
+}
+
+// enter marks a task as executed. Returns false if a task is executed already: an asynchronous task is then
+// executed once it has returned, see leave.
+func (h *InlineActionHandler) enter(threadSafeTask ThreadSafeTask, args interface{}, sync bool) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.executing {
+		h.executing = true
+		return true
+	}
+	if !sync {
+		h.pending = append(h.pending, inlineTask{task: threadSafeTask, args: args})
+	}
+	return false
+}
+
+// leave executes the asynchronous tasks sent while a task was executed, in order, then marks no task as executed
+func (h *InlineActionHandler) leave() {
+	for {
+		h.mutex.Lock()
+		if len(h.pending) == 0 {
+			h.executing = false
+			h.mutex.Unlock()
+			return
+		}
+		next := h.pending[0]
+		h.pending = h.pending[1:]
+		h.mutex.Unlock()
+		_, _ = h.run(next.task, next.args, false)
+	}
+}
+
+// run executes a task, reporting the panic of an asynchronous one
+func (h *InlineActionHandler) run(threadSafeTask ThreadSafeTask, args interface{}, sync bool) (interface{}, error) {
+	start := time.Now()
+	task := controlThreadSafeContext{ctx: context.Background(), task: threadSafeTask, args: args}
+	result, err := task.execute(task.ctx, nil)
+	if err == nil {
+		return result, nil
+	}
+	var panicErr *taskPanic
+	if !sync && errors.As(err, &panicErr) {
+		h.reporter.handleAsyncPanic(&ctrlAction{}, panicErr)
+	}
+	return nil, &ActionError{Sync: sync, Elapsed: time.Since(start), Err: err}
+}
@@ -0,0 +1,93 @@
+package action_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldExecuteTheTasksImmediatelyInTheCallerGoroutine(t *testing.T) {
+	var handler action.ThreadSafeActionHandlerIft = action.NewInlineActionHandler()
+
+	var executed []interface{}
+	handler.AsynchronousActionSend(recordTask(&executed), 1)
+	// The asynchronous task has been executed once the send returns
+	assert.DeepEqual(t, executed, []interface{}{1})
+	result, err := handler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args.(int) * 2, nil
+	}, 21)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 42)
+}
+
+func Test_ShouldReportTheInlineTaskErrorsLikeTheHandler(t *testing.T) {
+	handler := action.NewInlineActionHandler()
+	taskErr := errors.New("task error")
+
+	_, err := handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, nil)
+	assert.Assert(t, errors.Is(err, taskErr))
+	_, err = handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		panic("task panic")
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrTaskPanic))
+	handler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		panic("async task panic")
+	}, nil)
+	_, err = handler.SynchronousActionSend(nil, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+	_, err = handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return handler.SynchronousActionSend(recordTask(&[]interface{}{}), nil)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrReentrantSend))
+}
+
+func Test_ShouldSerializeTheInlineTasks(t *testing.T) {
+	handler := action.NewInlineActionHandler()
+
+	count := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+				count++
+				return nil, nil
+			}, nil)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, count, 100)
+}
+
+func Test_ShouldExecuteAnAsynchronousInlineSendFromATaskOnceItHasReturned(t *testing.T) {
+	handler := action.NewInlineActionHandler()
+
+	var executed []interface{}
+	_, err := handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		handler.AsynchronousActionSend(recordTask(&executed), "nested")
+		// As with ThreadSafeActionHandler, the nested task is not executed yet
+		executed = append(executed, "task")
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, executed, []interface{}{"task", "nested"})
+}
+
+func Test_ShouldReportTheInlineAsynchronousPanicsToThePanicHandler(t *testing.T) {
+	recovered := make(chan interface{}, 1)
+	handler := action.NewInlineActionHandler(action.WithPanicHandler(func(value interface{}, _ []byte) {
+		recovered <- value
+	}))
+
+	handler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		panic("async task panic")
+	}, nil)
+	assert.Equal(t, <-recovered, "async task panic")
+}
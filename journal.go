@@ -0,0 +1,97 @@
+package action
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JournalEntry records the execution of a task
+type JournalEntry struct {
+	// Seq is the execution sequence number of the task in its handler, starting at 1
+	Seq uint64
+	// Sync is true when the task has been sent synchronously
+	Sync bool
+	Args interface{}
+	// Result and Err are the task outcome, Err being the error returned to the caller
+	Result  interface{}
+	Err     error
+	Elapsed time.Duration
+}
+
+// Journal records the tasks executed by a handler, to debug or replay them.
+// Record is called from the handler loop, so it must be fast and must not send tasks to the handler. It is called
+// concurrently for the read tasks running at the same time.
+type Journal interface {
+	Record(entry JournalEntry)
+}
+
+// WithJournal records every task executed by the handler in j. The tasks discarded without being executed are not
+// recorded.
+func WithJournal(j Journal) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.journal = j
+	}
+}
+
+// record adds the execution of a user task to the journal, if any
+func (h *ThreadSafeActionHandler) record(ctrl *ctrlAction, result interface{}, err error, elapsed time.Duration) {
+	if h.journal == nil || ctrl.internal {
+		return
+	}
+	h.journal.Record(JournalEntry{
+		Seq:     atomic.AddUint64(&h.journalSeq, 1),
+		Sync:    ctrl.sync,
+		Args:    ctrl.ctrlThreadSafeCtx.args,
+		Result:  result,
+		Err:     err,
+		Elapsed: elapsed,
+	})
+}
+
+// MemoryJournal is an in-memory Journal keeping the most recent entries
+type MemoryJournal struct {
+	mutex    sync.Mutex
+	entries  []JournalEntry
+	capacity int
+}
+
+var _ Journal = (*MemoryJournal)(nil)
+
+// NewMemoryJournal creates a new MemoryJournal keeping up to capacity entries, the oldest ones being dropped first.
+// A zero or negative capacity keeps every entry.
+func NewMemoryJournal(capacity int) *MemoryJournal {
+	return &MemoryJournal{capacity: capacity}
+}
+
+// Record adds entry to the journal
+func (j *MemoryJournal) Record(entry JournalEntry) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.capacity > 0 && len(j.entries) == j.capacity {
+		copy(j.entries, j.entries[1:])
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	j.entries = append(j.entries, entry)
+}
+
+// Range calls fn for each entry in recording order, until fn returns false. The entries recorded meanwhile are not
+// iterated over: fn may use the handler.
+func (j *MemoryJournal) Range(fn func(entry JournalEntry) bool) {
+	j.mutex.Lock()
+	entries := make([]JournalEntry, len(j.entries))
+	copy(entries, j.entries)
+	j.mutex.Unlock()
+	for _, entry := range entries {
+		if !fn(entry) {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries in the journal
+func (j *MemoryJournal) Len() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.entries)
+}
@@ -0,0 +1,63 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldJournalTheExecutedTasksInOrder(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	journal := action.NewMemoryJournal(0)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithJournal(journal))
+	taskErr := errors.New("task error")
+
+	double := func(args interface{}) (interface{}, error) {
+		return args.(int) * 2, nil
+	}
+	_, err := actionHandler.SynchronousActionSend(double, 1)
+	assert.NilError(t, err)
+	actionHandler.AsynchronousActionSend(double, 2)
+	_, err = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, 3)
+	assert.Assert(t, errors.Is(err, taskErr))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	var entries []action.JournalEntry
+	journal.Range(func(entry action.JournalEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	assert.Equal(t, len(entries), 3)
+	for i, entry := range entries {
+		assert.Equal(t, entry.Seq, uint64(i+1))
+		assert.Equal(t, entry.Args, i+1)
+	}
+	assert.Assert(t, entries[0].Sync)
+	assert.Equal(t, entries[0].Result, 2)
+	assert.Assert(t, !entries[1].Sync)
+	assert.Equal(t, entries[1].Result, 4)
+	assert.Assert(t, errors.Is(entries[2].Err, taskErr))
+	assert.Equal(t, entries[2].Result, nil)
+}
+
+func Test_ShouldKeepTheMostRecentJournalEntries(t *testing.T) {
+	journal := action.NewMemoryJournal(2)
+	for i := 1; i <= 3; i++ {
+		journal.Record(action.JournalEntry{Seq: uint64(i)})
+	}
+	assert.Equal(t, journal.Len(), 2)
+
+	var seqs []uint64
+	journal.Range(func(entry action.JournalEntry) bool {
+		seqs = append(seqs, entry.Seq)
+		return false
+	})
+	assert.DeepEqual(t, seqs, []uint64{2})
+}
@@ -0,0 +1,110 @@
+package action
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyedThreadSafeActionHandler serializes tasks per key instead of globally: tasks sent for the same key are
+// executed in the same thread-safe context, while tasks sent for different keys run concurrently.
+// A ThreadSafeActionHandler is lazily started for each key and gracefully closed once the key has been idle for
+// the configured timeout.
+type KeyedThreadSafeActionHandler struct {
+	ctx         context.Context
+	idleTimeout time.Duration
+	opts        []Option
+
+	mutex    sync.Mutex
+	handlers map[string]*keyedHandler
+}
+
+type keyedHandler struct {
+	handler *ThreadSafeActionHandler
+	// nbSends counts the sends in progress for the key, the handler is not retired while it is positive
+	nbSends int
+	// generation is incremented on each send so that a pending retirement knows the key has been used again
+	generation  uint64
+	retireTimer *time.Timer
+}
+
+// NewKeyedThreadSafeActionHandler creates a new KeyedThreadSafeActionHandler whose per key handlers are
+// configured with the given options. A key handler is retired after idleTimeout without any send, or never if
+// idleTimeout is not positive.
+func NewKeyedThreadSafeActionHandler(ctx context.Context, idleTimeout time.Duration, opts ...Option) *KeyedThreadSafeActionHandler {
+	return &KeyedThreadSafeActionHandler{
+		ctx:         ctx,
+		idleTimeout: idleTimeout,
+		opts:        opts,
+		handlers:    map[string]*keyedHandler{},
+	}
+}
+
+// acquire returns the key handler, starting it if needed, and prevents its retirement until released
+func (k *KeyedThreadSafeActionHandler) acquire(key string) *keyedHandler {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	kh, exists := k.handlers[key]
+	if !exists {
+		kh = &keyedHandler{handler: NewThreadSafeActionHandler(k.ctx, k.opts...)}
+		k.handlers[key] = kh
+	}
+	kh.nbSends++
+	kh.generation++
+	if kh.retireTimer != nil {
+		kh.retireTimer.Stop()
+		kh.retireTimer = nil
+	}
+	return kh
+}
+
+// release ends a send for the key, scheduling the handler retirement once the key is idle
+func (k *KeyedThreadSafeActionHandler) release(key string, kh *keyedHandler) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	kh.nbSends--
+	if kh.nbSends > 0 || k.idleTimeout <= 0 {
+		return
+	}
+	generation := kh.generation
+	kh.retireTimer = time.AfterFunc(k.idleTimeout, func() {
+		k.retire(key, kh, generation)
+	})
+}
+
+// retire closes the key handler if no send happened since the given generation
+func (k *KeyedThreadSafeActionHandler) retire(key string, kh *keyedHandler, generation uint64) {
+	k.mutex.Lock()
+	if kh.nbSends > 0 || kh.generation != generation {
+		// The key has been used again in the meantime
+		k.mutex.Unlock()
+		return
+	}
+	delete(k.handlers, key)
+	k.mutex.Unlock()
+	// The asynchronous tasks already accepted are still executed
+	_ = kh.handler.Close()
+}
+
+// ActiveKeyCount returns the number of keys having a running handler
+func (k *KeyedThreadSafeActionHandler) ActiveKeyCount() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return len(k.handlers)
+}
+
+// SynchronousActionSendForKey sends an action to the key thread-safe action handler in a synchronous way.
+// See ThreadSafeActionHandler.SynchronousActionSend
+func (k *KeyedThreadSafeActionHandler) SynchronousActionSendForKey(key string, threadSafeTask ThreadSafeTask, args interface{}) (interface{}, error) {
+	kh := k.acquire(key)
+	defer k.release(key, kh)
+	return kh.handler.SynchronousActionSend(threadSafeTask, args)
+}
+
+// AsynchronousActionSendForKey sends an action to the key thread-safe action handler in an asynchronous way.
+// See ThreadSafeActionHandler.AsynchronousActionSend
+func (k *KeyedThreadSafeActionHandler) AsynchronousActionSendForKey(key string, threadSafeTask ThreadSafeTask, args interface{}) {
+	kh := k.acquire(key)
+	defer k.release(key, kh)
+	kh.handler.AsynchronousActionSend(threadSafeTask, args)
+}
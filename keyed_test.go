@@ -0,0 +1,102 @@
+package action_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldSerializeTasksForTheSameKey(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	keyedHandler := action.NewKeyedThreadSafeActionHandler(handlerCtx, time.Minute)
+
+	var running, maxRunning int32
+	counter := 0
+	incrementTask := func(args interface{}) (interface{}, error) {
+		if nbRunning := atomic.AddInt32(&running, 1); nbRunning > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, nbRunning)
+		}
+		defer atomic.AddInt32(&running, -1)
+		counter++
+		return nil, nil
+	}
+
+	nbConc := 100
+	allDone := make(chan error, nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func() {
+			_, err := keyedHandler.SynchronousActionSendForKey("key", incrementTask, nil)
+			allDone <- err
+		}()
+	}
+	for i := 0; i < nbConc; i++ {
+		assert.NilError(t, <-allDone)
+	}
+	assert.Equal(t, counter, nbConc)
+	assert.Equal(t, atomic.LoadInt32(&maxRunning), int32(1))
+	assert.Equal(t, keyedHandler.ActiveKeyCount(), 1)
+}
+
+func Test_ShouldRunTasksForDifferentKeysConcurrently(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	keyedHandler := action.NewKeyedThreadSafeActionHandler(handlerCtx, time.Minute)
+
+	// The key A task only returns once the key B one has run: this would dead lock with a global serialization
+	keyBDone := make(chan bool)
+	keyADone := make(chan error)
+	go func() {
+		_, err := keyedHandler.SynchronousActionSendForKey("A", func(args interface{}) (interface{}, error) {
+			<-keyBDone
+			return nil, nil
+		}, nil)
+		keyADone <- err
+	}()
+	keyedHandler.AsynchronousActionSendForKey("B", func(args interface{}) (interface{}, error) {
+		close(keyBDone)
+		return nil, nil
+	}, nil)
+
+	select {
+	case err := <-keyADone:
+		assert.NilError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("tasks for different keys have not run concurrently")
+	}
+	assert.Equal(t, keyedHandler.ActiveKeyCount(), 2)
+}
+
+func Test_ShouldRetireIdleKeys(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	idleTimeout := 10 * time.Millisecond
+	keyedHandler := action.NewKeyedThreadSafeActionHandler(handlerCtx, idleTimeout)
+	echoTask := func(args interface{}) (interface{}, error) {
+		return args, nil
+	}
+
+	for _, key := range []string{"A", "B", "C"} {
+		result, err := keyedHandler.SynchronousActionSendForKey(key, echoTask, key)
+		assert.NilError(t, err)
+		assert.Equal(t, result, key)
+	}
+	assert.Equal(t, keyedHandler.ActiveKeyCount(), 3)
+
+	deadline := time.Now().Add(time.Second)
+	for keyedHandler.ActiveKeyCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(idleTimeout)
+	}
+	assert.Equal(t, keyedHandler.ActiveKeyCount(), 0)
+
+	// A retired key is started again on the next send
+	result, err := keyedHandler.SynchronousActionSendForKey("A", echoTask, "A")
+	assert.NilError(t, err)
+	assert.Equal(t, result, "A")
+	assert.Equal(t, keyedHandler.ActiveKeyCount(), 1)
+}
@@ -0,0 +1,91 @@
+package action
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// lifecycle holds the state of a run of the handler loop, from its start to its exit
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// loopDone is closed when the handler loop returns
+	loopDone chan struct{}
+	// closed is protected by the handler closeMutex
+	closed    bool
+	closeOnce sync.Once
+	// state is the HandlerState, resumed is closed once a paused handler is resumed, see Pause
+	state      int32
+	pauseMutex sync.Mutex
+	resumed    chan struct{}
+}
+
+func newLifecycle(ctx context.Context) *lifecycle {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	handlerCtx, cancel := context.WithCancel(ctx)
+	return &lifecycle{
+		ctx:      handlerCtx,
+		cancel:   cancel,
+		loopDone: make(chan struct{}),
+	}
+}
+
+// current returns the lifecycle of the current run of the handler loop
+func (h *ThreadSafeActionHandler) current() *lifecycle {
+	return h.life.Load().(*lifecycle)
+}
+
+// handlerCtx returns the context of the current run of the handler loop
+func (h *ThreadSafeActionHandler) handlerCtx() context.Context {
+	return h.current().ctx
+}
+
+// Restart starts a new handler loop with ctx once the previous one is stopped, its context being done or the handler
+// being shut down: the handler accepts tasks again, with the same options. The task counters are reset: the pending,
+// queued, executed and discarded tasks as well as the queued bytes. The handler state owned by the tasks is left
+// as is.
+// Restart waits for the previous handler loop to exit and for the senders of the previous run to have handed their
+// task over or given up, so it must not be called from a thread-safe task.
+// Returns ErrHandlerRunning while the handler is not stopped. A nil ctx defaults to context.Background().
+func (h *ThreadSafeActionHandler) Restart(ctx context.Context) error {
+	previous := h.current()
+	if previous.ctx.Err() == nil {
+		return ErrHandlerRunning
+	}
+	<-previous.loopDone
+	// The senders of the previous run still handing their task over, such as a DetachedActionSend goroutine, would
+	// hand it over to the new handler loop: they give up first, as no task is accepted once the context is done
+	h.inflight.Wait()
+
+	h.closeMutex.Lock()
+	defer h.closeMutex.Unlock()
+	if h.current() != previous {
+		// Restarted concurrently
+		return ErrHandlerRunning
+	}
+	// The previous run has discarded every task left, and no task has been accepted since
+	atomic.StoreInt64(&h.pending, 0)
+	atomic.StoreInt64(&h.queued, 0)
+	atomic.StoreInt64(&h.executed, 0)
+	atomic.StoreInt64(&h.discarded, 0)
+	h.queueBytes.mutex.Lock()
+	h.queueBytes.queued = 0
+	h.queueBytes.mutex.Unlock()
+	h.barriers = nil
+	h.scheduledSeq = 0
+	life := newLifecycle(ctx)
+	h.life.Store(life)
+	go h.handlerLoop(life)
+	return nil
+}
+
+// Child creates a new handler configured with opts whose context is derived from the handler context: the child
+// handler is stopped along with the handler, when its context is done or once it is closed, so that cancelling the
+// parent cascades to the work it has spawned on the child. The child handler can still be closed on its own.
+// The child handler is bound to the current run of the handler loop: it is not restarted along with the handler.
+func (h *ThreadSafeActionHandler) Child(opts ...Option) *ThreadSafeActionHandler {
+	return NewThreadSafeActionHandler(h.handlerCtx(), opts...)
+}
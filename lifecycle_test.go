@@ -0,0 +1,125 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldRestartTheHandlerOnceItsContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	assert.Equal(t, actionHandler.Restart(context.TODO()), action.ErrHandlerRunning)
+
+	count := 0
+	increment := func(interface{}) (interface{}, error) {
+		count++
+		return count, nil
+	}
+	_, err := actionHandler.SynchronousActionSend(increment, nil)
+	assert.NilError(t, err)
+	cancelHandler()
+	<-actionHandler.Done()
+	_, err = actionHandler.SynchronousActionSend(increment, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+
+	restartCtx, cancelRestart := context.WithCancel(context.TODO())
+	defer cancelRestart()
+	assert.NilError(t, actionHandler.Restart(restartCtx))
+	assert.Equal(t, actionHandler.Restart(restartCtx), action.ErrHandlerRunning)
+	assert.Assert(t, actionHandler.Healthy())
+	// The state owned by the tasks is kept
+	result, err := actionHandler.SynchronousActionSend(increment, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 2)
+	assert.Equal(t, action.PendingTasks(actionHandler), 0)
+}
+
+func Test_ShouldRestartAClosedHandler(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO(), action.WithQueueSize(2))
+	var executed []interface{}
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 1)
+	assert.NilError(t, actionHandler.Close())
+	assert.Equal(t, actionHandler.Len(), 0)
+
+	assert.NilError(t, actionHandler.Restart(nil))
+	defer actionHandler.Close()
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 2)
+	assert.NilError(t, actionHandler.Flush(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{1, 2})
+	// The restarted handler can be closed again
+	assert.NilError(t, actionHandler.Close())
+	assert.Assert(t, !actionHandler.Healthy())
+}
+
+func Test_ShouldRestartOnceTheDetachedTasksOfThePreviousRunAreHandedOver(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	var executed []interface{}
+	handOver := action.DetachedActionSendHandOver(actionHandler, recordTask(&executed))
+	cancelHandler()
+
+	restarted := make(chan error, 1)
+	go func() {
+		restarted <- actionHandler.Restart(context.TODO())
+	}()
+	select {
+	case <-restarted:
+		t.Fatal("the handler has restarted before the detached task of the previous run has been handed over")
+	case <-time.After(20 * time.Millisecond):
+	}
+	handOver()
+	assert.NilError(t, <-restarted)
+	defer actionHandler.Close()
+
+	// The detached task has been discarded with the previous run instead of being accounted in the new one
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, action.PendingTasks(actionHandler), 0)
+	assert.Equal(t, len(executed), 0)
+}
+
+func Test_ShouldStopTheChildHandlerAlongWithItsParent(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	parent := action.NewThreadSafeActionHandler(handlerCtx)
+	child := parent.Child(action.WithName("child"))
+
+	// A task of the parent spawns work on the child
+	result, err := parent.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return child.SynchronousActionSend(func(interface{}) (interface{}, error) {
+			return "spawned", nil
+		}, nil)
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "spawned")
+
+	cancelHandler()
+	<-parent.Done()
+	<-child.Done()
+	_, err = child.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+}
+
+func Test_ShouldNotStopTheParentHandlerWithItsChild(t *testing.T) {
+	parent := action.NewThreadSafeActionHandler(context.TODO())
+	child := parent.Child()
+
+	assert.NilError(t, child.Close())
+	<-child.Done()
+	_, err := parent.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+
+	// Closing the parent stops the child created afterwards
+	otherChild := parent.Child()
+	assert.NilError(t, parent.Close())
+	<-otherChild.Done()
+}
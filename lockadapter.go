@@ -0,0 +1,40 @@
+package action
+
+// LockAdapter exposes a ThreadSafeActionHandler as a sync.RWMutex-like API to migrate a mutex based store
+// incrementally: the critical sections become functions passed to Do, instead of Lock, and to DoRead, instead of
+// RLock, while the rest of the code keeps accessing the store the same way.
+type LockAdapter struct {
+	handler *ThreadSafeActionHandler
+}
+
+// NewLockAdapter creates a new LockAdapter executing the critical sections with the given handler
+func NewLockAdapter(handler *ThreadSafeActionHandler) *LockAdapter {
+	return &LockAdapter{
+		handler: handler,
+	}
+}
+
+// Do executes fn exclusively, as under a sync.RWMutex lock.
+// Returns the fn error, ErrNilTask if fn is nil or the handler error. See ThreadSafeActionHandler.SynchronousActionSend
+func (a *LockAdapter) Do(fn func() error) error {
+	if fn == nil {
+		return ErrNilTask
+	}
+	_, err := a.handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, fn()
+	}, nil)
+	return err
+}
+
+// DoRead executes fn concurrently with the other reads but never with Do, as under a sync.RWMutex read lock.
+// Returns the fn error, ErrNilTask if fn is nil or the handler error.
+// See ThreadSafeActionHandler.SynchronousReadActionSend
+func (a *LockAdapter) DoRead(fn func() error) error {
+	if fn == nil {
+		return ErrNilTask
+	}
+	_, err := a.handler.SynchronousReadActionSend(func(interface{}) (interface{}, error) {
+		return nil, fn()
+	}, nil)
+	return err
+}
@@ -0,0 +1,152 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// lockedCounter is the same counter protected either by a sync.RWMutex or by a LockAdapter
+type lockedCounter interface {
+	increment()
+	read() int
+}
+
+type mutexCounter struct {
+	mutex sync.RWMutex
+	count int
+}
+
+func (c *mutexCounter) increment() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.count++
+}
+
+func (c *mutexCounter) read() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.count
+}
+
+type adapterCounter struct {
+	adapter *action.LockAdapter
+	count   int
+}
+
+func (c *adapterCounter) increment() {
+	_ = c.adapter.Do(func() error {
+		c.count++
+		return nil
+	})
+}
+
+func (c *adapterCounter) read() int {
+	var count int
+	_ = c.adapter.DoRead(func() error {
+		count = c.count
+		return nil
+	})
+	return count
+}
+
+// hammerCounter increments and reads the counter concurrently, checking that the reads never go backwards
+func hammerCounter(t *testing.T, counter lockedCounter) int {
+	nbConc := 50
+	nbOps := 100
+	var wg sync.WaitGroup
+	for i := 0; i < nbConc; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < nbOps; j++ {
+				counter.increment()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			last := 0
+			for j := 0; j < nbOps; j++ {
+				count := counter.read()
+				assert.Assert(t, count >= last)
+				last = count
+			}
+		}()
+	}
+	wg.Wait()
+	return counter.read()
+}
+
+func Test_ShouldBehaveLikeAnRWMutexForACounter(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	adapter := action.NewLockAdapter(action.NewThreadSafeActionHandler(handlerCtx))
+
+	expected := hammerCounter(t, &mutexCounter{})
+	assert.Equal(t, hammerCounter(t, &adapterCounter{adapter: adapter}), expected)
+}
+
+func Test_ShouldRunReadsConcurrentlyButNeverWithAWrite(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	adapter := action.NewLockAdapter(action.NewThreadSafeActionHandler(handlerCtx))
+
+	// Each read only returns once the other one is running: this would dead lock if they were serialized
+	var readersRunning sync.WaitGroup
+	readersRunning.Add(2)
+	readErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			readErrs <- adapter.DoRead(func() error {
+				readersRunning.Done()
+				readersRunning.Wait()
+				return nil
+			})
+		}()
+	}
+	assert.NilError(t, <-readErrs)
+	assert.NilError(t, <-readErrs)
+
+	var running, writeOverlaps int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = adapter.DoRead(func() error {
+				atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				return nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = adapter.Do(func() error {
+				if atomic.LoadInt32(&running) != 0 {
+					atomic.AddInt32(&writeOverlaps, 1)
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, atomic.LoadInt32(&writeOverlaps), int32(0))
+}
+
+func Test_ShouldReturnTheCriticalSectionError(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	adapter := action.NewLockAdapter(action.NewThreadSafeActionHandler(handlerCtx))
+	sectionErr := errors.New("section error")
+
+	assert.Assert(t, errors.Is(adapter.Do(func() error { return sectionErr }), sectionErr))
+	assert.Assert(t, errors.Is(adapter.DoRead(func() error { return sectionErr }), sectionErr))
+	assert.Equal(t, adapter.Do(nil), action.ErrNilTask)
+	assert.Equal(t, adapter.DoRead(nil), action.ErrNilTask)
+}
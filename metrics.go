@@ -0,0 +1,45 @@
+package action
+
+import (
+	"time"
+)
+
+// MetricsCollector receives the handler metrics as they are measured.
+// It keeps the core package free of any metrics dependency: a Prometheus adapter observes the durations in a
+// histogram and sets the queue depth on a gauge.
+// Its methods are called from the handler loop, so they must be fast and must not send tasks to the handler. They
+// are called concurrently for the read tasks running at the same time.
+type MetricsCollector interface {
+	// ObserveTaskDuration is called with the execution duration and the error of each task
+	ObserveTaskDuration(d time.Duration, err error)
+	// SetQueueDepth is called with the number of tasks waiting to be executed after each task execution
+	SetQueueDepth(n int)
+}
+
+// LatencyCollector is optionally implemented by a MetricsCollector to tell whether the latency of the tasks comes
+// from the backlog or from slow tasks. Like the MetricsCollector methods, its methods are called from the handler
+// loop.
+type LatencyCollector interface {
+	// ObserveQueueWait is called with the time each task has waited between its submission and its start
+	ObserveQueueWait(d time.Duration)
+	// ObserveExecution is called with the time spent executing each task
+	ObserveExecution(d time.Duration)
+}
+
+// WithMetrics reports the task durations and the queue depth to collector, as well as the queue wait and
+// execution durations if it implements LatencyCollector
+func WithMetrics(collector MetricsCollector) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.metrics = collector
+		h.latency, _ = collector.(LatencyCollector)
+	}
+}
+
+// observeLatency reports the queue wait and the execution duration of a user task, if a LatencyCollector is set
+func (h *ThreadSafeActionHandler) observeLatency(ctrl *ctrlAction, start time.Time, elapsed time.Duration) {
+	if h.latency == nil || ctrl.internal {
+		return
+	}
+	h.latency.ObserveQueueWait(start.Sub(ctrl.enqueuedAt))
+	h.latency.ObserveExecution(elapsed)
+}
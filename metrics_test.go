@@ -0,0 +1,136 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+type fakeMetricsCollector struct {
+	mutex       sync.Mutex
+	durations   []time.Duration
+	errs        []error
+	queueDepths chan int
+}
+
+func newFakeMetricsCollector() *fakeMetricsCollector {
+	return &fakeMetricsCollector{queueDepths: make(chan int, 100)}
+}
+
+func (c *fakeMetricsCollector) ObserveTaskDuration(d time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.durations = append(c.durations, d)
+	c.errs = append(c.errs, err)
+}
+
+func (c *fakeMetricsCollector) SetQueueDepth(n int) {
+	c.queueDepths <- n
+}
+
+func Test_ShouldObserveTheTaskDurationsAndErrors(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	collector := newFakeMetricsCollector()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithMetrics(collector))
+	taskErr := errors.New("task error")
+
+	_, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+	_, err = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, nil)
+	assert.Assert(t, errors.Is(err, taskErr))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	assert.Equal(t, len(collector.durations), 2)
+	assert.Assert(t, collector.durations[0] >= 10*time.Millisecond)
+	assert.Equal(t, len(collector.errs), 2)
+	assert.NilError(t, collector.errs[0])
+	assert.Equal(t, collector.errs[1], taskErr)
+}
+
+func Test_ShouldReportTheQueueDepthAfterEachTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	collector := newFakeMetricsCollector()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithMetrics(collector))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+	for i := 0; i < 3; i++ {
+		go actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			return nil, nil
+		}, nil)
+	}
+	waitForPendingTasks(t, actionHandler, 4)
+	close(release)
+
+	for _, expected := range []int{3, 2, 1, 0} {
+		assert.Equal(t, <-collector.queueDepths, expected)
+	}
+}
+
+type fakeLatencyCollector struct {
+	*fakeMetricsCollector
+	queueWaits []time.Duration
+	executions []time.Duration
+}
+
+func (c *fakeLatencyCollector) ObserveQueueWait(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queueWaits = append(c.queueWaits, d)
+}
+
+func (c *fakeLatencyCollector) ObserveExecution(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.executions = append(c.executions, d)
+}
+
+func Test_ShouldObserveTheQueueWaitOfATaskSubmittedBehindASlowOne(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	collector := &fakeLatencyCollector{fakeMetricsCollector: newFakeMetricsCollector()}
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithMetrics(collector))
+
+	started := make(chan struct{})
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		time.Sleep(30 * time.Millisecond)
+		return nil, nil
+	}, nil)
+	<-started
+	_, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	assert.Equal(t, len(collector.queueWaits), 2)
+	assert.Equal(t, len(collector.executions), 2)
+	// The slow task has been executed right away, while the next one waited for it
+	assert.Assert(t, collector.executions[0] >= 30*time.Millisecond)
+	assert.Assert(t, collector.queueWaits[0] < 20*time.Millisecond)
+	assert.Assert(t, collector.queueWaits[1] >= 20*time.Millisecond)
+	assert.Assert(t, collector.executions[1] < collector.queueWaits[1])
+}
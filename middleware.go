@@ -0,0 +1,20 @@
+package action
+
+// Middleware wraps the execution of a task to add a cross-cutting behavior (timing, checks, logging...).
+// It is executed in the thread-safe context, around every task of the handler.
+type Middleware func(next ThreadSafeTask) ThreadSafeTask
+
+// WithMiddleware runs every task through the given middlewares, the first one being the outermost
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.middlewares = append(h.middlewares, middlewares...)
+	}
+}
+
+// chainMiddlewares wraps threadSafeTask with the middlewares, the first one being the outermost
+func chainMiddlewares(middlewares []Middleware, threadSafeTask ThreadSafeTask) ThreadSafeTask {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		threadSafeTask = middlewares[i](threadSafeTask)
+	}
+	return threadSafeTask
+}
@@ -0,0 +1,64 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func recordingMiddleware(name string, events *[]string) action.Middleware {
+	return func(next action.ThreadSafeTask) action.ThreadSafeTask {
+		return func(args interface{}) (interface{}, error) {
+			*events = append(*events, name+" in")
+			defer func() {
+				*events = append(*events, name+" out")
+			}()
+			return next(args)
+		}
+	}
+}
+
+func Test_ShouldRunTasksThroughTheMiddlewaresOutermostFirst(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	var events []string
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithMiddleware(
+		recordingMiddleware("first", &events),
+		recordingMiddleware("second", &events),
+	))
+
+	result, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		events = append(events, "task")
+		return args, nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 1234)
+	assert.DeepEqual(t, events, []string{"first in", "second in", "task", "second out", "first out"})
+}
+
+func Test_ShouldLetAMiddlewareShortCircuitTheTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	errForbidden := errors.New("forbidden")
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithMiddleware(
+		func(next action.ThreadSafeTask) action.ThreadSafeTask {
+			return func(args interface{}) (interface{}, error) {
+				if args == "forbidden" {
+					return nil, errForbidden
+				}
+				return next(args)
+			}
+		},
+	))
+	executed := false
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, args interface{}) (interface{}, error) {
+		executed = true
+		return nil, nil
+	}, "forbidden")
+	assert.Assert(t, errors.Is(err, errForbidden))
+	assert.Assert(t, !executed)
+}
@@ -0,0 +1,103 @@
+package action
+
+import (
+	"time"
+)
+
+// Option configures a ThreadSafeActionHandler
+type Option func(*ThreadSafeActionHandler)
+
+// WithSlowTaskThreshold calls onSlow with the measured execution duration of every task running longer than
+// threshold. onSlow is called from its own goroutine so it never blocks the handler loop.
+func WithSlowTaskThreshold(threshold time.Duration, onSlow func(duration time.Duration)) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.slowTaskThreshold = threshold
+		h.onSlowTask = onSlow
+	}
+}
+
+// WithPanicHandler calls onPanic with the recovered value and the stack trace when an asynchronous task panics.
+// onPanic is called from its own goroutine. Without panic handler, the panic is logged.
+// A synchronous task panic is returned to the caller as an error matching ErrTaskPanic instead.
+// In every case the handler loop recovers and keeps executing the next tasks.
+func WithPanicHandler(onPanic func(recovered interface{}, stack []byte)) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.onPanic = func(_ string, recovered interface{}, stack []byte) {
+			onPanic(recovered, stack)
+		}
+	}
+}
+
+// WithMaxPending limits the number of synchronous sends waiting for their reply at the same time to maxPending.
+// Once the limit is reached, synchronous sends return ErrTooManyPending immediately instead of piling up.
+func WithMaxPending(maxPending int) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.maxPending = int64(maxPending)
+	}
+}
+
+// WithLoadShedding makes the synchronous sends return ErrOverloaded immediately instead of queueing their task once
+// maxQueue tasks are queued, see Len, so that the callers do not wait behind a backlog they would time out on anyway.
+// A zero or negative maxQueue disables the load shedding.
+func WithLoadShedding(maxQueue int) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.maxQueued = int64(maxQueue)
+	}
+}
+
+// WithLockedOSThread locks the handler loop goroutine to its OS thread, for tasks calling thread-affine C libraries:
+// the tasks are executed on the same OS thread, which the handler loop owns until it exits, no other goroutine
+// running on it meanwhile. It does not apply to the tasks executed outside of the handler loop: the read tasks, the
+// offloaded tasks and the tasks with a timeout, see WithDefaultTaskTimeout.
+func WithLockedOSThread() Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.lockOSThread = true
+	}
+}
+
+// defaultReplyTimeout is the reply timeout of the handlers created without WithReplyTimeout
+const defaultReplyTimeout = time.Second
+
+// WithReplyTimeout bounds the time the handler loop waits for a synchronous caller to receive the reply of its task
+// to timeout, after which the reply is dropped and logged. The reply channels are buffered so the handler loop never
+// waits for them in practice: the timeout guards it against a caller which would never receive its reply. A zero
+// or negative timeout restores the default of one second.
+func WithReplyTimeout(timeout time.Duration) Option {
+	return func(h *ThreadSafeActionHandler) {
+		if timeout <= 0 {
+			timeout = defaultReplyTimeout
+		}
+		h.replyTimeout = timeout
+	}
+}
+
+// WithName names the handler. The name is included in the errors returned once the handler is stopped and in the
+// handler logs, to tell handlers apart.
+func WithName(name string) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.name = name
+	}
+}
+
+// WithRateLimit caps the execution rate of the tasks to rps tasks per second. Once the rate is reached, the handler
+// loop waits before executing the next task, while the callers of synchronous sends can still give up on their
+// context. A zero or negative rps disables the limit.
+func WithRateLimit(rps int) Option {
+	return func(h *ThreadSafeActionHandler) {
+		if rps <= 0 {
+			h.rateLimiter = nil
+			return
+		}
+		h.rateLimiter = newRateLimiter(rps)
+	}
+}
+
+// WithDefaultTaskTimeout makes the synchronous sends return ErrActionTimeout once their task has been running for
+// timeout. Go cannot interrupt a task: it keeps running and its result is discarded, while the handler loop waits
+// for it to return before executing the next task, so that the tasks stay serialized.
+// Each task is then executed from its own goroutine. A zero timeout disables it.
+func WithDefaultTaskTimeout(timeout time.Duration) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.taskTimeout = timeout
+	}
+}
@@ -0,0 +1,365 @@
+package action_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldReportSlowTasks(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	threshold := 10 * time.Millisecond
+	slowTaskDurations := make(chan time.Duration, 1)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithSlowTaskThreshold(threshold,
+		func(duration time.Duration) {
+			slowTaskDurations <- duration
+		}))
+
+	_, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		time.Sleep(2 * threshold)
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+
+	select {
+	case duration := <-slowTaskDurations:
+		assert.Assert(t, duration >= threshold, "reported duration %s is below the threshold", duration)
+	case <-time.After(time.Second):
+		t.Fatal("slow task hook has not been called")
+	}
+}
+
+func Test_ShouldNotReportFastTasks(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	slowTaskDurations := make(chan time.Duration, 1)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithSlowTaskThreshold(time.Second,
+		func(duration time.Duration) {
+			slowTaskDurations <- duration
+		}))
+
+	_, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	select {
+	case duration := <-slowTaskDurations:
+		t.Fatalf("fast task reported as slow: %s", duration)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func Test_ShouldReportAsynchronousTaskPanicAndKeepRunning(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	type recoveredPanic struct {
+		value interface{}
+		stack string
+	}
+	panics := make(chan recoveredPanic, 1)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithPanicHandler(
+		func(recovered interface{}, stack []byte) {
+			panics <- recoveredPanic{value: recovered, stack: string(stack)}
+		}))
+
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		panic("something wrong happened")
+	}, nil)
+	result, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 1234)
+
+	select {
+	case recovered := <-panics:
+		assert.Equal(t, recovered.value, "something wrong happened")
+		assert.Assert(t, strings.Contains(recovered.stack, "options_test.go"))
+	case <-time.After(time.Second):
+		t.Fatal("panic handler has not been called")
+	}
+}
+
+func Test_ShouldReturnSynchronousTaskPanicAsAnErrorToTheCaller(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithPanicHandler(
+		func(recovered interface{}, stack []byte) {
+			t.Error("panic handler called for a synchronous task")
+		}))
+
+	result, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		panic("something wrong happened")
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrTaskPanic))
+	assert.ErrorContains(t, err, "something wrong happened")
+	assert.Equal(t, result, nil)
+
+	// The handler must still be usable
+	result, err = actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return args, nil
+	}, 1234)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 1234)
+}
+
+func Test_ShouldLogAsynchronousTaskPanicByDefault(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		panic("something wrong happened")
+	}, nil)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	assert.Assert(t, strings.Contains(logs.String(), "thread-safe task panicked: something wrong happened"))
+}
+
+func Test_ShouldRejectSynchronousSendsOverTheMaxPendingLimit(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	maxPending := 10
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithMaxPending(maxPending))
+	doNothingTask := func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	done := make(chan bool)
+	hasBeenCalled := make(chan bool)
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		hasBeenCalled <- true
+		<-done
+		return nil, nil
+	}, nil)
+	<-hasBeenCalled
+
+	// Fill the capacity with synchronous sends waiting for the blocking task
+	allDone := make(chan error, maxPending)
+	for i := 0; i < maxPending; i++ {
+		go func() {
+			_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+			allDone <- err
+		}()
+	}
+	waitForPendingTasks(t, actionHandler, maxPending+1)
+
+	nbConc := 50
+	rejected := make(chan error, nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func() {
+			_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+			rejected <- err
+		}()
+	}
+	for i := 0; i < nbConc; i++ {
+		assert.Equal(t, <-rejected, action.ErrTooManyPending)
+	}
+
+	close(done)
+	for i := 0; i < maxPending; i++ {
+		assert.NilError(t, <-allDone)
+	}
+	_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+	assert.NilError(t, err)
+}
+
+func Test_ShouldIncludeTheHandlerNameInErrors(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithName("subscriptions"))
+	cancelHandler()
+
+	_, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Error(t, err, `thread-safe action handler "subscriptions": context canceled`)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	var handlerErr *action.HandlerError
+	assert.Assert(t, errors.As(err, &handlerErr))
+	assert.Equal(t, handlerErr.Name, "subscriptions")
+
+	closedHandler := action.NewThreadSafeActionHandler(context.TODO(), action.WithName("themes"))
+	assert.NilError(t, closedHandler.Close())
+	_, err = closedHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.Error(t, err, `thread-safe action handler "themes": thread-safe action handler is closed`)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+	assert.Assert(t, errors.Is(err, action.ErrHandlerClosed))
+}
+
+func Test_ShouldIncludeTheHandlerNameInLogs(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithName("subscriptions"))
+
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		panic("something wrong happened")
+	}, nil)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	assert.Assert(t, strings.Contains(logs.String(),
+		`thread-safe action handler "subscriptions": thread-safe task panicked: something wrong happened`))
+}
+
+func Test_ShouldTimeOutATaskRunningLongerThanTheDefaultTimeout(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithDefaultTaskTimeout(10*time.Millisecond))
+
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	start := time.Now()
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		defer close(returned)
+		<-release
+		return "too late", nil
+	}, nil)
+	assert.Equal(t, err, action.ErrActionTimeout)
+	assert.Equal(t, result, nil)
+	assert.Assert(t, time.Since(start) < time.Second)
+
+	// The next task waits for the timed out one to return
+	nextStarted := make(chan struct{})
+	go func() {
+		_, _ = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+			close(nextStarted)
+			return nil, nil
+		}, nil)
+	}()
+	select {
+	case <-nextStarted:
+		t.Fatal("the next task should not run while the timed out one is still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-returned
+	<-nextStarted
+
+	result, err = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return "in time", nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "in time")
+}
+
+func Test_ShouldDetectReentrantSendsOfTasksWithATimeout(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithDefaultTaskTimeout(time.Second))
+
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return actionHandler.SynchronousActionSendCtx(ctx, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		}, nil)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrReentrantSend))
+}
+
+func Test_ShouldShedTheSynchronousSendsOnceTooManyTasksAreQueued(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	maxQueue := 5
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithLoadShedding(maxQueue))
+	doNothingTask := func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	release := blockHandler(actionHandler)
+
+	// Drive the queue up to the threshold with asynchronous sends waiting for the blocked handler loop
+	for i := 0; i < maxQueue; i++ {
+		go actionHandler.AsynchronousActionSend(doNothingTask, nil)
+	}
+	for actionHandler.Len() < maxQueue {
+		time.Sleep(time.Millisecond)
+	}
+
+	nbConc := 50
+	shed := make(chan error, nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func() {
+			_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+			shed <- err
+		}()
+	}
+	for i := 0; i < nbConc; i++ {
+		assert.Equal(t, <-shed, action.ErrOverloaded)
+	}
+
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	_, err := actionHandler.SynchronousActionSend(doNothingTask, nil)
+	assert.NilError(t, err)
+}
+
+func Test_ShouldExecuteTheTasksWithTheHandlerLoopLockedToItsOSThread(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithLockedOSThread())
+
+	count := 0
+	for i := 0; i < 100; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			count++
+			return nil, nil
+		}, nil)
+	}
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return count, nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 100)
+
+	// The handler loop unlocks its thread on exit and can be restarted
+	cancelHandler()
+	<-actionHandler.Done()
+	assert.NilError(t, actionHandler.Restart(context.TODO()))
+	defer actionHandler.Close()
+	_, err = actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+}
+
+func Test_ShouldKeepProcessingTheTasksWhenACallerNeverReceivesItsReply(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	replyTimeout := 10 * time.Millisecond
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithReplyTimeout(replyTimeout))
+
+	abandonedExecuted := false
+	start := time.Now()
+	assert.NilError(t, action.SendAbandoned(actionHandler, func(interface{}) (interface{}, error) {
+		abandonedExecuted = true
+		return "never received", nil
+	}))
+	// The next task is executed once the reply has been dropped
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return "received", nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "received")
+	assert.Assert(t, abandonedExecuted)
+	assert.Assert(t, time.Since(start) >= replyTimeout)
+	assert.Assert(t, strings.Contains(logs.String(), "reply of a synchronous task dropped"))
+}
@@ -0,0 +1,57 @@
+package action
+
+// Order defines in which order the handler loop executes the queued tasks
+type Order int
+
+const (
+	// FIFO executes the queued tasks in submission order, the default order
+	FIFO Order = iota
+	// LIFO executes the most recently submitted queued task first
+	LIFO
+)
+
+// WithExecutionOrder defines in which order the handler loop executes the tasks queued while it was busy.
+// In LIFO order, the handler loop takes every task ready to be accepted off the queue before selecting the most
+// recent one: the tasks waiting for their turn do not take room in the queue anymore, see WithQueueSize.
+// Flush still waits for every task accepted before the call, whatever the order.
+// WithScheduler takes precedence over WithExecutionOrder.
+func WithExecutionOrder(order Order) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.order = order
+	}
+}
+
+// newScheduler returns the scheduler executing the tasks in order, nil for FIFO as the queue is already in
+// submission order
+func newScheduler(order Order) Scheduler {
+	switch order {
+	case LIFO:
+		return &lifoScheduler{}
+	default:
+		return nil
+	}
+}
+
+// lifoScheduler is a stack of tasks
+type lifoScheduler struct {
+	stack []*QueuedTask
+}
+
+func (s *lifoScheduler) Push(task *QueuedTask) {
+	s.stack = append(s.stack, task)
+}
+
+func (s *lifoScheduler) Pop() *QueuedTask {
+	if len(s.stack) == 0 {
+		return nil
+	}
+	last := len(s.stack) - 1
+	task := s.stack[last]
+	s.stack[last] = nil
+	s.stack = s.stack[:last]
+	return task
+}
+
+func (s *lifoScheduler) Len() int {
+	return len(s.stack)
+}
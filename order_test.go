@@ -0,0 +1,96 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldExecuteTheQueuedTasksInSubmissionOrderByDefault(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(3),
+		action.WithExecutionOrder(action.FIFO))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{1, 2, 3})
+}
+
+func Test_ShouldExecuteTheMostRecentQueuedTaskFirstInLIFOOrder(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(3),
+		action.WithExecutionOrder(action.LIFO))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{3, 2, 1})
+
+	// Once the handler loop is idle, a task is executed as soon as it is submitted
+	_, err := actionHandler.SynchronousActionSend(recordTask(&executed), 4)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, executed, []interface{}{3, 2, 1, 4})
+}
+
+func Test_ShouldFlushEveryTaskAcceptedBeforeTheCallInLIFOOrder(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(4),
+		action.WithExecutionOrder(action.LIFO))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	flushed := make(chan error)
+	go func() {
+		flushed <- actionHandler.Flush(context.TODO())
+	}()
+	release()
+	assert.NilError(t, <-flushed)
+	_, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return len(executed), nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(executed), 3)
+}
+
+func Test_ShouldDiscardTheTasksLeftInTheLIFOQueueOnceTheHandlerIsStopped(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(3),
+		action.WithExecutionOrder(action.LIFO))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	acks := []<-chan bool{
+		actionHandler.AsynchronousActionSendAck(recordTask(&executed), 1),
+		actionHandler.AsynchronousActionSendAck(recordTask(&executed), 2),
+		// The most recent task is executed first and stops the handler
+		actionHandler.AsynchronousActionSendAck(func(interface{}) (interface{}, error) {
+			cancelHandler()
+			return nil, nil
+		}, nil),
+	}
+	release()
+	assert.Assert(t, <-acks[2])
+	assert.Assert(t, !<-acks[1])
+	assert.Assert(t, !<-acks[0])
+	<-actionHandler.Done()
+	assert.Equal(t, len(executed), 0)
+}
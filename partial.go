@@ -0,0 +1,56 @@
+package action
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// SynchronousActionSendPartial sends an action to the thread-safe action handler in a synchronous way, like
+// SynchronousActionSendCtx, except that once the task has started, the caller waits for it even when ctx is done: a
+// long-running task polls ctx.Done() and returns its partial result, which is returned to the caller along with
+// ctx error. The task result is returned along with the task error as well.
+// A task not started yet when ctx is done is not executed, nil and ctx error being returned.
+func (h *ThreadSafeActionHandler) SynchronousActionSendPartial(ctx context.Context, threadSafeTask ThreadSafeTaskCtx, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.synchronousSend(ctx, threadSafeTask, args, false, withPartialResult())
+}
+
+// withPartialResult makes the synchronous caller wait for the result of the started task whatever its context, see
+// SynchronousActionSendPartial
+func withPartialResult() TaskOption {
+	return func(c *ctrlAction) {
+		c.partial = true
+	}
+}
+
+// awaitPartial waits for the reply of a synchronous action sent with SynchronousActionSendPartial
+func (h *ThreadSafeActionHandler) awaitPartial(ctx context.Context, handlerCtx context.Context, ctrl *ctrlAction) (interface{}, error) {
+	select {
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&ctrl.state, actionQueued, actionCancelled) {
+			return nil, h.callCtxErr(ctx)
+		}
+		// The task has started: wait for its partial result
+		select {
+		case <-handlerCtx.Done():
+			return nil, h.stoppedErr(handlerCtx.Err())
+		case reply := <-ctrl.ctrlReplyChannel:
+			return h.partialReply(ctx, ctrl, reply)
+		}
+	case <-handlerCtx.Done():
+		return nil, h.stoppedErr(handlerCtx.Err())
+	case reply := <-ctrl.ctrlReplyChannel:
+		return h.partialReply(ctx, ctrl, reply)
+	}
+}
+
+// partialReply returns the task result along with its error, or ctx error if the task succeeded once ctx is done
+func (h *ThreadSafeActionHandler) partialReply(ctx context.Context, ctrl *ctrlAction, reply taskReply) (interface{}, error) {
+	replyChannelPool.Put(ctrl.ctrlReplyChannel)
+	if reply.err == nil && ctx.Err() != nil {
+		return reply.result, h.callCtxErr(ctx)
+	}
+	return reply.result, reply.err
+}
@@ -0,0 +1,75 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldReturnThePartialResultOfACancelledTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	result, err := actionHandler.SynchronousActionSendPartial(ctx, func(ctx context.Context, args interface{}) (interface{}, error) {
+		var done []int
+		for step := 1; step <= args.(int); step++ {
+			select {
+			case <-ctx.Done():
+				return done, nil
+			default:
+			}
+			done = append(done, step)
+			if step == 3 {
+				// Cancel the call once 3 steps are done
+				cancel()
+			}
+		}
+		return done, nil
+	}, 10)
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	assert.DeepEqual(t, result, []int{1, 2, 3})
+
+	// The task error is returned along with its partial result as well
+	taskErr := errors.New("task error")
+	result, err = actionHandler.SynchronousActionSendPartial(context.TODO(), func(context.Context, interface{}) (interface{}, error) {
+		return []int{1}, taskErr
+	}, nil)
+	assert.Assert(t, errors.Is(err, taskErr))
+	assert.DeepEqual(t, result, []int{1})
+}
+
+func Test_ShouldNotExecuteAPartialTaskCancelledBeforeStarting(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(1))
+	release := blockHandler(actionHandler)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	executed := false
+	sent := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendPartial(ctx, func(context.Context, interface{}) (interface{}, error) {
+			executed = true
+			return nil, nil
+		}, nil)
+		sent <- err
+	}()
+	cancel()
+	assert.Assert(t, errors.Is(<-sent, context.Canceled))
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, !executed)
+}
+
+func Test_ShouldRejectANilPartialTask(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	defer actionHandler.Close()
+	_, err := actionHandler.SynchronousActionSendPartial(context.TODO(), nil, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+}
@@ -0,0 +1,57 @@
+package action
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// PooledThreadSafeActionHandler serializes tasks per key over a fixed pool of ThreadSafeActionHandler workers:
+// the key is hashed to a worker, so tasks sent for the same key are always executed by the same worker while the
+// number of goroutines stays bounded whatever the number of keys.
+// Unlike KeyedThreadSafeActionHandler, keys sharing a worker are serialized together.
+type PooledThreadSafeActionHandler struct {
+	workers []*ThreadSafeActionHandler
+}
+
+// NewPooledThreadSafeActionHandler creates a new PooledThreadSafeActionHandler starting workers handlers
+// configured with the given options. At least one worker is started.
+func NewPooledThreadSafeActionHandler(ctx context.Context, workers int, opts ...Option) *PooledThreadSafeActionHandler {
+	if workers < 1 {
+		workers = 1
+	}
+	pool := &PooledThreadSafeActionHandler{
+		workers: make([]*ThreadSafeActionHandler, workers),
+	}
+	for i := range pool.workers {
+		pool.workers[i] = NewThreadSafeActionHandler(ctx, opts...)
+	}
+	return pool
+}
+
+// worker returns the handler executing the tasks of the key
+func (p *PooledThreadSafeActionHandler) worker(key string) *ThreadSafeActionHandler {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return p.workers[hash.Sum32()%uint32(len(p.workers))]
+}
+
+// SynchronousActionSendForKey sends an action to the key worker in a synchronous way.
+// See ThreadSafeActionHandler.SynchronousActionSend
+func (p *PooledThreadSafeActionHandler) SynchronousActionSendForKey(key string, threadSafeTask ThreadSafeTask, args interface{}) (interface{}, error) {
+	return p.worker(key).SynchronousActionSend(threadSafeTask, args)
+}
+
+// AsynchronousActionSendForKey sends an action to the key worker in an asynchronous way.
+// See ThreadSafeActionHandler.AsynchronousActionSend
+func (p *PooledThreadSafeActionHandler) AsynchronousActionSendForKey(key string, threadSafeTask ThreadSafeTask, args interface{}) {
+	p.worker(key).AsynchronousActionSend(threadSafeTask, args)
+}
+
+// Close gracefully shuts every worker down, waiting for all the submitted tasks to be executed.
+// See ThreadSafeActionHandler.Close
+func (p *PooledThreadSafeActionHandler) Close() error {
+	for _, worker := range p.workers {
+		_ = worker.Close()
+	}
+	return nil
+}
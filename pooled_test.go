@@ -0,0 +1,75 @@
+package action_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// trackConcurrency returns a task recording in maxRunning the maximum number of tasks running at the same time
+func trackConcurrency(running, maxRunning *int32, duration time.Duration) action.ThreadSafeTask {
+	return func(interface{}) (interface{}, error) {
+		nbRunning := atomic.AddInt32(running, 1)
+		defer atomic.AddInt32(running, -1)
+		for {
+			current := atomic.LoadInt32(maxRunning)
+			if nbRunning <= current || atomic.CompareAndSwapInt32(maxRunning, current, nbRunning) {
+				break
+			}
+		}
+		time.Sleep(duration)
+		return nil, nil
+	}
+}
+
+func Test_ShouldSerializeTasksForTheSameKeyOnAPooledHandler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	pooledHandler := action.NewPooledThreadSafeActionHandler(handlerCtx, 4)
+
+	var running, maxRunning int32
+	tracked := trackConcurrency(&running, &maxRunning, 0)
+	counter := 0
+	incrementTask := func(args interface{}) (interface{}, error) {
+		counter++
+		return tracked(args)
+	}
+
+	nbConc := 100
+	allDone := make(chan error, nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func() {
+			_, err := pooledHandler.SynchronousActionSendForKey("key", incrementTask, nil)
+			allDone <- err
+		}()
+	}
+	for i := 0; i < nbConc; i++ {
+		assert.NilError(t, <-allDone)
+	}
+	assert.Equal(t, counter, nbConc)
+	assert.Equal(t, atomic.LoadInt32(&maxRunning), int32(1))
+}
+
+func Test_ShouldNotRunMoreTasksThanWorkersAtTheSameTime(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	workers := 3
+	pooledHandler := action.NewPooledThreadSafeActionHandler(handlerCtx, workers)
+
+	var running, maxRunning int32
+	task := trackConcurrency(&running, &maxRunning, 5*time.Millisecond)
+	nbKeys := 30
+	for i := 0; i < nbKeys; i++ {
+		pooledHandler.AsynchronousActionSendForKey(fmt.Sprintf("key %d", i), task, nil)
+	}
+	assert.NilError(t, pooledHandler.Close())
+
+	assert.Assert(t, atomic.LoadInt32(&maxRunning) <= int32(workers), "%d tasks ran at the same time", maxRunning)
+	assert.Assert(t, atomic.LoadInt32(&maxRunning) > 1, "the tasks of different keys should run concurrently")
+}
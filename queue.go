@@ -0,0 +1,124 @@
+package action
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// QueuePolicy defines what an asynchronous send does once the handler queue is full
+type QueuePolicy int
+
+const (
+	// QueueBlock waits for the handler loop to accept the task, the default policy
+	QueueBlock QueuePolicy = iota
+	// QueueDropNewest rejects the task being sent
+	QueueDropNewest
+	// QueueDropOldest evicts the oldest queued task to make room for the task being sent
+	QueueDropOldest
+)
+
+// drainPollInterval is the delay between two checks for tasks still being sent once the handler loop has exited
+const drainPollInterval = time.Millisecond
+
+// WithQueueSize buffers up to size tasks accepted but not executed yet, so that the sends do not wait for the
+// handler loop to be available. Without queue, each send waits for the handler loop to accept its task.
+func WithQueueSize(size int) Option {
+	return func(h *ThreadSafeActionHandler) {
+		if size < 0 {
+			size = 0
+		}
+		h.queueSize = size
+	}
+}
+
+// WithFullQueuePolicy defines what the asynchronous sends do once the queue is full, see WithQueueSize.
+// The evicted or rejected tasks are reported as discarded: AsynchronousActionSendAck receives false and
+// AsynchronousActionSendCallback is called with ErrTaskDropped or ErrQueueFull. An evicted synchronous task
+// returns ErrTaskDropped. Synchronous sends always wait for the queue to have room.
+// Without queue, QueueDropOldest has no queued task to evict: the asynchronous sends wait as with QueueBlock.
+func WithFullQueuePolicy(policy QueuePolicy) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.queuePolicy = policy
+	}
+}
+
+// sendAsyncAction sends an asynchronous action to the handler loop, applying the full queue policy
+func (h *ThreadSafeActionHandler) sendAsyncAction(action *ctrlAction) error {
+	if err := h.acquire(); err != nil {
+		return err
+	}
+	policy := h.fullQueuePolicy()
+	if err := h.reserveBytes(h.handlerCtx(), action, policy); err != nil {
+		h.deadLetter(action, err)
+		h.releaseQueued(action)
+		return err
+	}
+	if policy == QueueBlock {
+		if h.queueSize > 0 {
+			// Fast path while the queue has room: a single producer does not pay for the full select
+			select {
+			case h.ctrlChannel <- action:
+				return nil
+			default:
+			}
+		}
+		return h.deliver(h.handlerCtx(), action)
+	}
+	for {
+		select {
+		case h.ctrlChannel <- action:
+			return nil
+		default:
+		}
+		if policy == QueueDropNewest {
+			h.deadLetter(action, ErrQueueFull)
+			h.releaseQueued(action)
+			return ErrQueueFull
+		}
+		handlerCtx := h.handlerCtx()
+		select {
+		case <-handlerCtx.Done():
+			err := h.stoppedErr(handlerCtx.Err())
+			h.deadLetter(action, err)
+			h.releaseQueued(action)
+			return err
+		case oldest := <-h.ctrlChannel:
+			h.discardQueued(oldest, ErrTaskDropped)
+		default:
+			// The handler loop has made room in the meantime
+		}
+	}
+}
+
+// fullQueuePolicy returns the policy applied by the asynchronous sends once the queue is full. Without queue, an
+// action received from ctrlChannel would not be a queued one but the one of a concurrent send, synchronous or
+// internal: QueueDropOldest then waits as QueueBlock.
+func (h *ThreadSafeActionHandler) fullQueuePolicy() QueuePolicy {
+	if h.queuePolicy == QueueDropOldest && h.queueSize == 0 {
+		return QueueBlock
+	}
+	return h.queuePolicy
+}
+
+// drainQueue discards the tasks left in the queue once the handler loop has exited, until no task is being sent
+// anymore: as the handler context is done, no new task is accepted.
+func (h *ThreadSafeActionHandler) drainQueue() {
+	if h.scheduler != nil {
+		for ctrl := h.popScheduled(); ctrl != nil; ctrl = h.popScheduled() {
+			h.discardQueued(ctrl, h.stoppedErr(h.handlerCtx().Err()))
+		}
+	}
+	for {
+		h.closeMutex.Lock()
+		pending := atomic.LoadInt64(&h.pending)
+		h.closeMutex.Unlock()
+		if pending == 0 {
+			return
+		}
+		select {
+		case ctrl := <-h.ctrlChannel:
+			h.discardQueued(ctrl, h.stoppedErr(h.handlerCtx().Err()))
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
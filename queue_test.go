@@ -0,0 +1,274 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// blockHandler keeps the handler loop busy until the returned function is called
+func blockHandler(actionHandler *action.ThreadSafeActionHandler) func() {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil)
+	<-started
+	return func() { close(release) }
+}
+
+// recordTask returns a task appending args to executed
+func recordTask(executed *[]interface{}) action.ThreadSafeTask {
+	return func(args interface{}) (interface{}, error) {
+		*executed = append(*executed, args)
+		return nil, nil
+	}
+}
+
+func Test_ShouldBlockAsynchronousSendsOnceTheQueueIsFull(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(2))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	// The queued sends return without waiting for the busy handler loop
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 1)
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 2)
+	sent := make(chan struct{})
+	go func() {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), 3)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("the send should wait for the queue to have room")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	<-sent
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{1, 2, 3})
+}
+
+func Test_ShouldRejectTheNewestTaskOnceTheQueueIsFull(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(2),
+		action.WithFullQueuePolicy(action.QueueDropNewest))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	acks := []<-chan bool{
+		actionHandler.AsynchronousActionSendAck(recordTask(&executed), 1),
+		actionHandler.AsynchronousActionSendAck(recordTask(&executed), 2),
+		actionHandler.AsynchronousActionSendAck(recordTask(&executed), 3),
+	}
+	dropped := make(chan error, 1)
+	actionHandler.AsynchronousActionSendCallback(recordTask(&executed), 4, func(_ interface{}, err error) {
+		dropped <- err
+	})
+	assert.Assert(t, !<-acks[2])
+	assert.Equal(t, <-dropped, action.ErrQueueFull)
+
+	release()
+	assert.Assert(t, <-acks[0])
+	assert.Assert(t, <-acks[1])
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{1, 2})
+}
+
+func Test_ShouldEvictTheOldestTaskOnceTheQueueIsFull(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(2),
+		action.WithFullQueuePolicy(action.QueueDropOldest))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	evicted := make(chan error, 1)
+	actionHandler.AsynchronousActionSendCallback(recordTask(&executed), 1, func(_ interface{}, err error) {
+		evicted <- err
+	})
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 2)
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 3)
+	assert.Equal(t, <-evicted, action.ErrTaskDropped)
+
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{2, 3})
+}
+
+func Test_ShouldNotEvictTheConcurrentSendsWithoutQueue(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithFullQueuePolicy(action.QueueDropOldest))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	synced := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSend(recordTask(&executed), "sync")
+		synced <- err
+	}()
+	flushed := make(chan error)
+	go func() {
+		flushed <- actionHandler.Flush(context.TODO())
+	}()
+	waitForPendingTasks(t, actionHandler, 3)
+	// Without queue, the send waits for the handler loop instead of evicting the concurrent ones
+	sent := make(chan bool)
+	go func() {
+		sent <- <-actionHandler.AsynchronousActionSendAck(recordTask(&executed), "async")
+	}()
+	waitForPendingTasks(t, actionHandler, 4)
+	release()
+
+	assert.NilError(t, <-synced)
+	assert.NilError(t, <-flushed)
+	assert.Assert(t, <-sent)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, len(executed), 2)
+}
+
+func Test_ShouldDiscardTheQueuedTasksWhenTheContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(10))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	acks := make([]<-chan bool, 5)
+	for i := range acks {
+		acks[i] = actionHandler.AsynchronousActionSendAck(recordTask(&executed), i)
+	}
+	errChan := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSend(recordTask(&executed), nil)
+		errChan <- err
+	}()
+	waitForPendingTasks(t, actionHandler, 7)
+	cancelHandler()
+	release()
+
+	assert.Assert(t, errors.Is(<-errChan, action.ErrHandlerStopped))
+	for _, ack := range acks {
+		assert.Assert(t, !<-ack)
+	}
+	<-actionHandler.Done()
+	assert.Equal(t, action.PendingTasks(actionHandler), 0)
+	// Nothing is left to drain: closing does not wait
+	assert.NilError(t, actionHandler.Close())
+	assert.Equal(t, len(executed), 0)
+}
+
+func Test_ShouldReportTheNumberOfQueuedTasks(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(2),
+		action.WithFullQueuePolicy(action.QueueDropOldest))
+	assert.Equal(t, actionHandler.Len(), 0)
+	release := blockHandler(actionHandler)
+	// The running task is not queued
+	assert.Equal(t, actionHandler.Len(), 0)
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	// The oldest task has been evicted
+	assert.Equal(t, actionHandler.Len(), 2)
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, actionHandler.Len(), 0)
+	assert.DeepEqual(t, executed, []interface{}{2, 3})
+
+	release = blockHandler(actionHandler)
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 4)
+	assert.Equal(t, actionHandler.Len(), 1)
+	cancelHandler()
+	release()
+	<-actionHandler.Done()
+	assert.Equal(t, actionHandler.Len(), 0)
+}
+
+func Test_ShouldEnqueueATaskAndReturnBeforeItsExecution(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(1))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	assert.NilError(t, actionHandler.EnqueueAndReturn(recordTask(&executed), 1))
+	synced := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSend(recordTask(&executed), 2)
+		synced <- err
+	}()
+	release()
+	assert.NilError(t, <-synced)
+	// The enqueued task has been executed before the synchronous task sent afterwards
+	assert.DeepEqual(t, executed, []interface{}{1, 2})
+}
+
+func Test_ShouldReturnTheEnqueueErrors(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(1),
+		action.WithFullQueuePolicy(action.QueueDropNewest))
+
+	var executed []interface{}
+	assert.Equal(t, actionHandler.EnqueueAndReturn(nil, nil), action.ErrNilTask)
+	_, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		// The queue has room for a single task
+		if err := actionHandler.EnqueueAndReturn(recordTask(&executed), 1); err != nil {
+			return nil, err
+		}
+		return nil, actionHandler.EnqueueAndReturn(recordTask(&executed), 2)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrQueueFull))
+	release := blockHandler(actionHandler)
+	assert.NilError(t, actionHandler.EnqueueAndReturn(recordTask(&executed), 3))
+	assert.Equal(t, actionHandler.EnqueueAndReturn(recordTask(&executed), 4), action.ErrQueueFull)
+	release()
+
+	assert.NilError(t, actionHandler.Close())
+	assert.Assert(t, errors.Is(actionHandler.EnqueueAndReturn(recordTask(&executed), 5), action.ErrHandlerClosed))
+	assert.DeepEqual(t, executed, []interface{}{1, 3})
+}
+
+func Benchmark_AsyncSingleProducer(b *testing.B) {
+	doNothingTask := func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	for _, bench := range []struct {
+		name string
+		opts []action.Option
+	}{
+		{name: "queue size 0", opts: []action.Option{action.WithQueueSize(0)}},
+		// The fast path only applies to QueueBlock
+		{name: "queue size 1024 drop newest", opts: []action.Option{action.WithQueueSize(1024), action.WithFullQueuePolicy(action.QueueDropNewest)}},
+		{name: "queue size 1024", opts: []action.Option{action.WithQueueSize(1024)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+			defer cancelHandler()
+			actionHandler := action.NewThreadSafeActionHandler(handlerCtx, bench.opts...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				actionHandler.AsynchronousActionSend(doNothingTask, nil)
+			}
+			_ = actionHandler.WaitIdle(context.TODO())
+		})
+	}
+}
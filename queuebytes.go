@@ -0,0 +1,111 @@
+package action
+
+import (
+	"context"
+	"sync"
+)
+
+// Sizer returns the approximate size in bytes of the args of a task, see WithMaxQueueBytes.
+// It is called from the sending goroutine with the args of every task, nil included.
+type Sizer func(args interface{}) int64
+
+// queueBytes tracks the approximate size of the args of the tasks submitted but not started yet
+type queueBytes struct {
+	max   int64
+	sizer Sizer
+	mutex sync.Mutex
+	// queued is the size of the queued tasks, freed is closed and reset once some of them leave the queue
+	queued int64
+	freed  chan struct{}
+}
+
+// WithMaxQueueBytes caps the approximate size of the args of the tasks submitted but not started yet to maxBytes,
+// for the tasks whose args are too large for the queue size alone to bound the memory, see WithQueueSize.
+// Once the cap is reached, the asynchronous sends apply the full queue policy, see WithFullQueuePolicy, while the
+// synchronous sends wait for the queue to have room. A task larger than maxBytes is accepted once the queue is
+// empty. The size of the args is given by the WithSizer function, or is the length of the string and []byte args
+// without it, the other args having no size. A zero or negative maxBytes disables the cap.
+func WithMaxQueueBytes(maxBytes int64) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.queueBytes.max = maxBytes
+	}
+}
+
+// WithSizer sets the function giving the size of the args of the tasks, see WithMaxQueueBytes
+func WithSizer(sizer Sizer) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.queueBytes.sizer = sizer
+	}
+}
+
+// sizeOf returns the size of the args of a task
+func (q *queueBytes) sizeOf(args interface{}) int64 {
+	if q.sizer != nil {
+		return q.sizer(args)
+	}
+	switch value := args.(type) {
+	case string:
+		return int64(len(value))
+	case []byte:
+		return int64(len(value))
+	}
+	return 0
+}
+
+// reserveBytes accounts the size of an acquired action in the queued bytes once the queue has room for it, applying
+// policy while it has not. Gives up when ctx or the handler context is done.
+func (h *ThreadSafeActionHandler) reserveBytes(ctx context.Context, action *ctrlAction, policy QueuePolicy) error {
+	if h.queueBytes.max <= 0 || action.internal {
+		return nil
+	}
+	size := h.queueBytes.sizeOf(action.ctrlThreadSafeCtx.args)
+	handlerCtx := h.handlerCtx()
+	for {
+		h.queueBytes.mutex.Lock()
+		if size == 0 || h.queueBytes.queued == 0 || h.queueBytes.queued+size <= h.queueBytes.max {
+			h.queueBytes.queued += size
+			h.queueBytes.mutex.Unlock()
+			action.size = size
+			return nil
+		}
+		if h.queueBytes.freed == nil {
+			h.queueBytes.freed = make(chan struct{})
+		}
+		freed := h.queueBytes.freed
+		h.queueBytes.mutex.Unlock()
+
+		switch policy {
+		case QueueDropNewest:
+			return ErrQueueFull
+		case QueueDropOldest:
+			select {
+			case oldest := <-h.ctrlChannel:
+				h.discardQueued(oldest, ErrTaskDropped)
+				continue
+			default:
+				// Nothing to evict: the queued tasks are already taken by the handler loop
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return h.callCtxErr(ctx)
+		case <-handlerCtx.Done():
+			return h.stoppedErr(handlerCtx.Err())
+		case <-freed:
+		}
+	}
+}
+
+// releaseBytes removes the size of an action leaving the queue from the queued bytes
+func (h *ThreadSafeActionHandler) releaseBytes(action *ctrlAction) {
+	if action.size == 0 {
+		return
+	}
+	h.queueBytes.mutex.Lock()
+	h.queueBytes.queued -= action.size
+	if h.queueBytes.freed != nil {
+		close(h.queueBytes.freed)
+		h.queueBytes.freed = nil
+	}
+	h.queueBytes.mutex.Unlock()
+}
@@ -0,0 +1,78 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldRejectTheNewestTaskOnceTheQueuedBytesReachTheCap(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(10),
+		action.WithMaxQueueBytes(1000), action.WithFullQueuePolicy(action.QueueDropNewest))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	large := make([]byte, 400)
+	assert.NilError(t, actionHandler.EnqueueAndReturn(recordTask(&executed), large))
+	assert.NilError(t, actionHandler.EnqueueAndReturn(recordTask(&executed), large))
+	// Only 2 tasks are queued out of 10, but the third one would exceed the 1000 bytes
+	err := actionHandler.EnqueueAndReturn(recordTask(&executed), large)
+	assert.Assert(t, errors.Is(err, action.ErrQueueFull))
+	// Small tasks still fit
+	assert.NilError(t, actionHandler.EnqueueAndReturn(recordTask(&executed), "small"))
+	assert.Equal(t, actionHandler.Len(), 3)
+
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, len(executed), 3)
+	// The queue has room again
+	assert.NilError(t, actionHandler.EnqueueAndReturn(recordTask(&executed), large))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+}
+
+func Test_ShouldBlockTheSendsOnceTheQueuedBytesReachTheCap(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	sizer := func(args interface{}) int64 {
+		size, _ := args.(int)
+		return int64(size)
+	}
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(10),
+		action.WithMaxQueueBytes(100), action.WithSizer(sizer))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 60)
+	sent := make(chan struct{})
+	go func() {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), 50)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("the send should wait for the queue to have room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// A synchronous send gives up on its context
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err := actionHandler.SynchronousActionSendCtx(ctx, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}, 50)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+
+	release()
+	<-sent
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{60, 50})
+	// A task larger than the cap is accepted once the queue is empty
+	_, err = actionHandler.SynchronousActionSend(recordTask(&executed), 500)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,28 @@
+package action
+
+import (
+	"time"
+)
+
+// rateLimiter is a token bucket holding a single token, refilled every interval.
+// It is only used from the handler loop so it is not protected against concurrent accesses.
+type rateLimiter struct {
+	interval time.Duration
+	// next is the time the next token is available at
+	next time.Time
+}
+
+func newRateLimiter(rps int) *rateLimiter {
+	return &rateLimiter{interval: time.Second / time.Duration(rps)}
+}
+
+// wait takes the next token and returns a channel receiving once it is available
+func (l *rateLimiter) wait() <-chan time.Time {
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	available := l.next
+	l.next = available.Add(l.interval)
+	return time.After(available.Sub(now))
+}
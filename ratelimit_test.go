@@ -0,0 +1,71 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldCapTheTaskExecutionRate(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	rps := 50
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithRateLimit(rps))
+
+	nbTasks := 20
+	executed := 0
+	start := time.Now()
+	for i := 0; i < nbTasks; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			executed++
+			return nil, nil
+		}, nil)
+	}
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	elapsed := time.Since(start)
+
+	assert.Equal(t, executed, nbTasks)
+	// The first task is executed immediately, the next ones every 1/rps second
+	minExpected := time.Duration(nbTasks-1) * time.Second / time.Duration(rps)
+	assert.Assert(t, elapsed >= minExpected, "%d tasks executed in %v", nbTasks, elapsed)
+	assert.Assert(t, elapsed < 2*minExpected, "%d tasks executed in %v", nbTasks, elapsed)
+}
+
+func Test_ShouldStopWaitingForARateLimitedTaskWhenTheCallContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithRateLimit(1))
+
+	task := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), task, nil)
+	assert.NilError(t, err)
+
+	callCtx, cancelCall := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancelCall()
+	start := time.Now()
+	_, err = actionHandler.SynchronousActionSendCtx(callCtx, task, nil)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Assert(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func Test_ShouldNotLimitTheRateByDefault(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithRateLimit(0))
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+			return nil, nil
+		}, nil)
+	}
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,76 @@
+package action
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// WithAutoRecover restarts the handler loop on the same context when it panics outside of a task, in a hook such as
+// a MetricsCollector, a Journal or a task callback, instead of crashing the program: a single unforeseen panic does
+// not wedge the handler. The action being dispatched, unless already released, and its follow-ups are discarded with
+// an error matching ErrLoopPanic. The panic is reported like the panic of an asynchronous task, see
+// WithPanicHandler. The loop is not restarted once the handler context is done.
+// The panics of the read and offloaded tasks hooks, which run in their own goroutine, are not recovered.
+func WithAutoRecover() Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.autoRecover = true
+	}
+}
+
+// serve takes the actions until the handler loop exits. Returns true when the loop has recovered from a panic and
+// must be restarted, see WithAutoRecover.
+func (h *ThreadSafeActionHandler) serve(life *lifecycle) (restart bool) {
+	if h.autoRecover {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				h.recoverLoop(recovered, debug.Stack())
+				restart = life.ctx.Err() == nil
+			}
+		}()
+	}
+	for {
+		if !life.awaitResume() || !h.awaitStep() {
+			return false
+		}
+		ctrl, ok := h.nextAction()
+		if !ok {
+			return false
+		}
+		h.dequeue(ctrl)
+		h.dispatch(ctrl)
+		h.runDeferred()
+		h.stepDone()
+	}
+}
+
+// recoverLoop reports a panic of the handler loop and discards the action being dispatched and its follow-ups
+func (h *ThreadSafeActionHandler) recoverLoop(recovered interface{}, stack []byte) {
+	ctrl := h.dispatching
+	h.dispatching = nil
+	h.running.Store((*ctrlAction)(nil))
+	var id string
+	if ctrl != nil {
+		id = ctrl.id
+	}
+	if h.onPanic == nil {
+		h.logf("handler loop recovered from a panic: %v\n%s", recovered, stack)
+	} else {
+		go h.onPanic(id, recovered, stack)
+	}
+	err := fmt.Errorf("%w: %v", ErrLoopPanic, recovered)
+	if ctrl != nil && atomic.LoadUint32(&ctrl.released) == 0 {
+		h.discard(ctrl, err)
+	}
+	deferred := h.deferred
+	h.deferred = nil
+	if ctrl != nil {
+		deferred = append(deferred, ctrl.closeFollowUps()...)
+	}
+	for _, followUp := range deferred {
+		if followUp != nil {
+			h.dequeue(followUp)
+			h.discard(followUp, err)
+		}
+	}
+}
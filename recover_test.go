@@ -0,0 +1,78 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// panickingCollector is a LatencyCollector panicking on its first observed execution, from the handler loop but
+// outside of the task
+type panickingCollector struct {
+	observed int32
+}
+
+func (c *panickingCollector) ObserveTaskDuration(time.Duration, error) {}
+
+func (c *panickingCollector) SetQueueDepth(int) {}
+
+func (c *panickingCollector) ObserveQueueWait(time.Duration) {}
+
+func (c *panickingCollector) ObserveExecution(time.Duration) {
+	if atomic.AddInt32(&c.observed, 1) == 1 {
+		panic("collector failure")
+	}
+}
+
+func Test_ShouldRestartTheHandlerLoopAfterAnInternalPanic(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	panics := make(chan interface{}, 1)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithAutoRecover(),
+		action.WithMetrics(&panickingCollector{}),
+		action.WithIdentifiedPanicHandler(func(id string, recovered interface{}, _ []byte) {
+			panics <- recovered
+		}))
+
+	// The task being dispatched when the loop panics is given up
+	_, err := actionHandler.SynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+		return "lost", nil
+	}, nil, action.WithID("first"))
+	assert.Assert(t, errors.Is(err, action.ErrLoopPanic))
+	assert.Equal(t, <-panics, "collector failure")
+
+	// The restarted loop processes the subsequent tasks
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return "processed", nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "processed")
+	assert.Assert(t, actionHandler.Healthy())
+	assert.Equal(t, action.PendingTasks(actionHandler), 0)
+	assert.NilError(t, actionHandler.Close())
+}
+
+func Test_ShouldDiscardTheFollowUpsOfTheTaskWhoseDispatchPanicked(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithAutoRecover(),
+		action.WithMetrics(&panickingCollector{}), action.WithPanicHandler(func(interface{}, []byte) {}))
+
+	followedUp := false
+	_, err := actionHandler.SynchronousActionSendCtx(context.TODO(), func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return nil, actionHandler.ScheduleAfter(ctx, func(context.Context, interface{}) (interface{}, error) {
+			followedUp = true
+			return nil, nil
+		}, nil)
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrLoopPanic))
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Assert(t, !followedUp)
+	assert.Equal(t, action.PendingTasks(actionHandler), 0)
+}
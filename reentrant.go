@@ -0,0 +1,62 @@
+package action
+
+import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// reentrantCheckDelay is how long a synchronous send waits behind the running task before checking whether it is
+// made by this very task, which would wait forever: the goroutine id is only looked up by the sends stalled that
+// long, never on the hot path
+const reentrantCheckDelay = 10 * time.Millisecond
+
+// runningTask returns the exclusive task executed by the handler loop, nil between tasks
+func (h *ThreadSafeActionHandler) runningTask() *ctrlAction {
+	running, _ := h.running.Load().(*ctrlAction)
+	return running
+}
+
+// stalled returns a channel closed once reentrantCheckDelay has elapsed since the first send made while the task
+// was running: the timer is shared by all the sends waiting behind the task
+func (c *ctrlAction) stalled() <-chan struct{} {
+	c.stallOnce.Do(func() {
+		c.stall = make(chan struct{})
+		time.AfterFunc(reentrantCheckDelay, func() {
+			close(c.stall)
+		})
+	})
+	return c.stall
+}
+
+// stallChannel returns the channel closed once the synchronous action has waited for reentrantCheckDelay behind the
+// task running when it was sent, nil if no task was running
+func (c *ctrlAction) stallChannel() <-chan struct{} {
+	if c.behind == nil {
+		return nil
+	}
+	return c.behind.stalled()
+}
+
+// sentByRunningTask reports whether the stalled synchronous action has been sent by the task it waits behind: the
+// task cannot return before its send, which would never return either
+func (h *ThreadSafeActionHandler) sentByRunningTask(action *ctrlAction) bool {
+	return h.runningTask() == action.behind && atomic.LoadUint64(&action.behind.goroutine) == currentGoroutineID()
+}
+
+// currentGoroutineID returns the id of the calling goroutine, parsed from the "goroutine <id> [status]:" header of
+// its stack trace
+func currentGoroutineID() uint64 {
+	var buffer [64]byte
+	header := buffer[:runtime.Stack(buffer[:], false)]
+	header = header[len("goroutine "):]
+	for i, char := range header {
+		if char == ' ' {
+			header = header[:i]
+			break
+		}
+	}
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
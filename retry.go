@@ -0,0 +1,60 @@
+package action
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy defines how a failing task is retried inside the thread-safe context
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of executions, including the first one
+	MaxAttempts int
+	// Backoff returns the delay to wait before the given retry (starting at 1). No delay when nil
+	Backoff func(retry int) time.Duration
+	// IsRetryable reports whether a task error is transient. Every error is retried when nil
+	IsRetryable func(error) bool
+}
+
+func (p RetryPolicy) isRetryable(err error) bool {
+	return p.IsRetryable == nil || p.IsRetryable(err)
+}
+
+func (p RetryPolicy) wait(ctx context.Context, retry int) error {
+	if p.Backoff == nil {
+		return nil
+	}
+	timer := time.NewTimer(p.Backoff(retry))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return nil
+}
+
+// wrap returns a task executing threadSafeTask until it succeeds or the policy gives up.
+// The whole retry loop runs as a single task, so the retries stay serialized with the other tasks.
+func (p RetryPolicy) wrap(ctx context.Context, threadSafeTask ThreadSafeTask) ThreadSafeTask {
+	return func(args interface{}) (interface{}, error) {
+		result, err := threadSafeTask(args)
+		for retry := 1; err != nil && retry < p.MaxAttempts && p.isRetryable(err); retry++ {
+			if waitErr := p.wait(ctx, retry); waitErr != nil {
+				return nil, waitErr
+			}
+			result, err = threadSafeTask(args)
+		}
+		return result, err
+	}
+}
+
+// SynchronousActionSendWithRetry sends an action to the thread-safe action handler in a synchronous way,
+// retrying it according to the policy while it fails with a retryable error.
+// The handler loop is busy during the backoff delays: no other task is executed in between.
+// Returns the result of the last execution
+func (h *ThreadSafeActionHandler) SynchronousActionSendWithRetry(threadSafeTask ThreadSafeTask, args interface{}, policy RetryPolicy) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.SynchronousActionSend(policy.wrap(h.handlerCtx(), threadSafeTask), args)
+}
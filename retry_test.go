@@ -0,0 +1,124 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+var errTransient = errors.New("transient error")
+
+func Test_ShouldRetryTaskUntilItSucceeds(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	nbExecutions := 0
+	flakyTask := func(args interface{}) (interface{}, error) {
+		nbExecutions++
+		if nbExecutions < 3 {
+			return nil, errTransient
+		}
+		return args, nil
+	}
+	var retries []int
+	policy := action.RetryPolicy{
+		MaxAttempts: 5,
+		Backoff: func(retry int) time.Duration {
+			retries = append(retries, retry)
+			return time.Millisecond
+		},
+	}
+
+	result, err := actionHandler.SynchronousActionSendWithRetry(flakyTask, 1234, policy)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 1234)
+	assert.Equal(t, nbExecutions, 3)
+	assert.DeepEqual(t, retries, []int{1, 2})
+}
+
+func Test_ShouldStopRetryingAfterMaxAttempts(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	nbExecutions := 0
+	failingTask := func(args interface{}) (interface{}, error) {
+		nbExecutions++
+		return nil, errTransient
+	}
+
+	_, err := actionHandler.SynchronousActionSendWithRetry(failingTask, nil, action.RetryPolicy{MaxAttempts: 3})
+	assert.Assert(t, errors.Is(err, errTransient))
+	assert.Equal(t, nbExecutions, 3)
+}
+
+func Test_ShouldNotRetryNonRetryableErrors(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	permanentErr := errors.New("permanent error")
+	nbExecutions := 0
+	failingTask := func(args interface{}) (interface{}, error) {
+		nbExecutions++
+		return nil, permanentErr
+	}
+	policy := action.RetryPolicy{
+		MaxAttempts: 3,
+		IsRetryable: func(err error) bool {
+			return err == errTransient
+		},
+	}
+
+	_, err := actionHandler.SynchronousActionSendWithRetry(failingTask, nil, policy)
+	assert.Assert(t, errors.Is(err, permanentErr))
+	assert.Equal(t, nbExecutions, 1)
+}
+
+func Test_ShouldSerializeRetriesWithOtherTasks(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	var events []string
+	nbExecutions := 0
+	firstExecution := make(chan bool, 1)
+	flakyTask := func(args interface{}) (interface{}, error) {
+		nbExecutions++
+		events = append(events, "flaky")
+		if nbExecutions == 1 {
+			firstExecution <- true
+		}
+		if nbExecutions < 3 {
+			return nil, errTransient
+		}
+		return nil, nil
+	}
+	otherTask := func(args interface{}) (interface{}, error) {
+		events = append(events, "other")
+		return nil, nil
+	}
+	policy := action.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff: func(retry int) time.Duration {
+			return 10 * time.Millisecond
+		},
+	}
+
+	retryDone := make(chan error)
+	go func() {
+		_, err := actionHandler.SynchronousActionSendWithRetry(flakyTask, nil, policy)
+		retryDone <- err
+	}()
+	<-firstExecution
+	_, err := actionHandler.SynchronousActionSend(otherTask, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, <-retryDone)
+	assert.DeepEqual(t, events, []string{"flaky", "flaky", "flaky", "other"})
+}
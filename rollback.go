@@ -0,0 +1,43 @@
+package action
+
+import (
+	"context"
+)
+
+// TaskWithRollback is a thread-safe task which returns, along with its result, the function undoing its changes.
+// The rollback may be nil when there is nothing to undo.
+type TaskWithRollback func(interface{}) (interface{}, func(), error)
+
+// SynchronousActionSendWithRollback sends an action to the thread-safe action handler in a synchronous way, and
+// stores the rollback returned by the task if it succeeds, to be run later by RollbackLast.
+// The rollbacks are stored until run, so the tasks whose changes never need to be undone should not return one.
+// See SynchronousActionSend.
+func (h *ThreadSafeActionHandler) SynchronousActionSendWithRollback(threadSafeTask TaskWithRollback, args interface{}) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.synchronousSend(h.handlerCtx(), func(_ context.Context, args interface{}) (interface{}, error) {
+		result, rollback, err := threadSafeTask(args)
+		if err == nil && rollback != nil {
+			h.rollbacks = append(h.rollbacks, rollback)
+		}
+		return result, err
+	}, args, false)
+}
+
+// RollbackLast runs, in the thread-safe context, the rollback of the latest task sent with
+// SynchronousActionSendWithRollback not rolled back yet, and returns once it is done.
+// Returns ErrNothingToRollback if there is no such task.
+func (h *ThreadSafeActionHandler) RollbackLast() error {
+	_, err := h.synchronousSend(h.handlerCtx(), func(context.Context, interface{}) (interface{}, error) {
+		if len(h.rollbacks) == 0 {
+			return nil, ErrNothingToRollback
+		}
+		rollback := h.rollbacks[len(h.rollbacks)-1]
+		h.rollbacks[len(h.rollbacks)-1] = nil
+		h.rollbacks = h.rollbacks[:len(h.rollbacks)-1]
+		rollback()
+		return nil, nil
+	}, nil, false)
+	return err
+}
@@ -0,0 +1,49 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldRestoreTheStateWhenRollingBackTheLastTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	balance := 100
+	withdraw := func(args interface{}) (interface{}, func(), error) {
+		amount := args.(int)
+		if amount > balance {
+			return nil, nil, errors.New("insufficient balance")
+		}
+		balance -= amount
+		return balance, func() { balance += amount }, nil
+	}
+	result, err := actionHandler.SynchronousActionSendWithRollback(withdraw, 30)
+	assert.NilError(t, err)
+	assert.Equal(t, result, 70)
+	_, err = actionHandler.SynchronousActionSendWithRollback(withdraw, 50)
+	assert.NilError(t, err)
+	// A failed task stores no rollback
+	_, err = actionHandler.SynchronousActionSendWithRollback(withdraw, 500)
+	assert.ErrorContains(t, err, "insufficient balance")
+
+	assert.NilError(t, actionHandler.RollbackLast())
+	assert.Equal(t, readBalance(t, actionHandler, &balance), 70)
+	assert.NilError(t, actionHandler.RollbackLast())
+	assert.Equal(t, readBalance(t, actionHandler, &balance), 100)
+	assert.Assert(t, errors.Is(actionHandler.RollbackLast(), action.ErrNothingToRollback))
+}
+
+func readBalance(t *testing.T, actionHandler *action.ThreadSafeActionHandler, balance *int) interface{} {
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return *balance, nil
+	}, nil)
+	assert.NilError(t, err)
+	return result
+}
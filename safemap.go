@@ -0,0 +1,71 @@
+package action
+
+// SafeMap is a map safe for concurrent use: every access is a task of its handler, the reads running concurrently
+// with each other but never with a write
+type SafeMap[K comparable, V any] struct {
+	handler *ThreadSafeActionHandler
+	// entries is only accessed by the tasks of handler
+	entries map[K]V
+}
+
+// NewSafeMap creates an empty SafeMap whose accesses are executed by handler, which may handle other state as well
+func NewSafeMap[K comparable, V any](handler *ThreadSafeActionHandler) *SafeMap[K, V] {
+	return &SafeMap[K, V]{handler: handler, entries: map[K]V{}}
+}
+
+// Get returns the value of key and whether it is set, or the zero value with the handler error
+func (m *SafeMap[K, V]) Get(key K) (V, bool, error) {
+	result, err := m.handler.SynchronousReadActionSend(func(interface{}) (interface{}, error) {
+		value, found := m.entries[key]
+		return pair[V, bool]{first: value, second: found}, nil
+	}, nil)
+	if err != nil {
+		var zero V
+		return zero, false, err
+	}
+	entry := result.(pair[V, bool])
+	return entry.first, entry.second, nil
+}
+
+// Set sets the value of key, returning once it is visible to the other accesses
+func (m *SafeMap[K, V]) Set(key K, value V) error {
+	_, err := m.handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		m.entries[key] = value
+		return nil, nil
+	}, nil)
+	return err
+}
+
+// Delete removes key, if set
+func (m *SafeMap[K, V]) Delete(key K) error {
+	_, err := m.handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		delete(m.entries, key)
+		return nil, nil
+	}, nil)
+	return err
+}
+
+// Len returns the number of keys set
+func (m *SafeMap[K, V]) Len() (int, error) {
+	result, err := m.handler.SynchronousReadActionSend(func(interface{}) (interface{}, error) {
+		return len(m.entries), nil
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int), nil
+}
+
+// Range calls f for each key and value in a single task, so that they are a consistent view of the map, until f
+// returns false. Like a task, f must not access the map itself.
+func (m *SafeMap[K, V]) Range(f func(key K, value V) bool) error {
+	_, err := m.handler.SynchronousReadActionSend(func(interface{}) (interface{}, error) {
+		for key, value := range m.entries {
+			if !f(key, value) {
+				break
+			}
+		}
+		return nil, nil
+	}, nil)
+	return err
+}
@@ -0,0 +1,128 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldSetGetAndDeleteTheEntriesOfASafeMap(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	safeMap := action.NewSafeMap[string, int](action.NewThreadSafeActionHandler(handlerCtx))
+
+	assert.NilError(t, safeMap.Set("foo", 1))
+	assert.NilError(t, safeMap.Set("bar", 2))
+	value, found, err := safeMap.Get("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, value, 1)
+	assert.Assert(t, found)
+
+	assert.NilError(t, safeMap.Delete("foo"))
+	assert.NilError(t, safeMap.Delete("unknown"))
+	value, found, err = safeMap.Get("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, value, 0)
+	assert.Assert(t, !found)
+	length, err := safeMap.Len()
+	assert.NilError(t, err)
+	assert.Equal(t, length, 1)
+}
+
+func Test_ShouldKeepASafeMapConsistentUnderConcurrentAccesses(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	safeMap := action.NewSafeMap[string, int](action.NewThreadSafeActionHandler(handlerCtx))
+	nbKeys := 100
+
+	// Concurrent sets, each followed by a get of its own key
+	setsDone := make(chan error)
+	for i := 0; i < nbKeys; i++ {
+		go func(i int) {
+			key := fmt.Sprintf("key %d", i)
+			if err := safeMap.Set(key, i); err != nil {
+				setsDone <- err
+				return
+			}
+			value, found, err := safeMap.Get(key)
+			if err == nil && (!found || value != i) {
+				err = fmt.Errorf("%s: got %d, %t", key, value, found)
+			}
+			setsDone <- err
+		}(i)
+	}
+	for i := 0; i < nbKeys; i++ {
+		assert.NilError(t, <-setsDone)
+	}
+
+	// Concurrent deletes of the odd keys while ranging over a consistent view of the map
+	deletesDone := make(chan error)
+	for i := 1; i < nbKeys; i += 2 {
+		go func(i int) {
+			deletesDone <- safeMap.Delete(fmt.Sprintf("key %d", i))
+		}(i)
+	}
+	for i := 0; i < nbKeys/2; i++ {
+		length, err := safeMap.Len()
+		assert.NilError(t, err)
+		ranged, mismatches := 0, 0
+		assert.NilError(t, safeMap.Range(func(key string, value int) bool {
+			if key != fmt.Sprintf("key %d", value) {
+				mismatches++
+			}
+			ranged++
+			return true
+		}))
+		assert.Equal(t, mismatches, 0)
+		assert.Assert(t, length >= nbKeys/2 && length <= nbKeys)
+		assert.Assert(t, ranged >= nbKeys/2 && ranged <= length)
+	}
+	for i := 1; i < nbKeys; i += 2 {
+		assert.NilError(t, <-deletesDone)
+	}
+
+	var values []int
+	assert.NilError(t, safeMap.Range(func(_ string, value int) bool {
+		values = append(values, value)
+		return true
+	}))
+	sort.Ints(values)
+	for i, value := range values {
+		assert.Equal(t, value, 2*i)
+	}
+	assert.Equal(t, len(values), nbKeys/2)
+}
+
+func Test_ShouldStopRangingOverASafeMapWhenAsked(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	safeMap := action.NewSafeMap[int, string](action.NewThreadSafeActionHandler(handlerCtx))
+	for i := 0; i < 10; i++ {
+		assert.NilError(t, safeMap.Set(i, "value"))
+	}
+
+	ranged := 0
+	assert.NilError(t, safeMap.Range(func(int, string) bool {
+		ranged++
+		return ranged < 3
+	}))
+	assert.Equal(t, ranged, 3)
+}
+
+func Test_ShouldReturnTheHandlerErrorFromASafeMap(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	safeMap := action.NewSafeMap[string, int](actionHandler)
+	assert.NilError(t, actionHandler.Close())
+
+	assert.Assert(t, errors.Is(safeMap.Set("foo", 1), action.ErrHandlerStopped))
+	_, _, err := safeMap.Get("foo")
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+	_, err = safeMap.Len()
+	assert.Assert(t, errors.Is(err, action.ErrHandlerStopped))
+}
@@ -0,0 +1,196 @@
+package action
+
+// QueuedTask is a task accepted by the handler loop and waiting for a Scheduler to select it
+type QueuedTask struct {
+	// Class is the class the task has been tagged with at submission, see WithClass
+	Class string
+	// Sync is true when the task has been sent synchronously
+	Sync bool
+	ctrl *ctrlAction
+	// seq is the acceptance sequence number of the task by the handler loop
+	seq uint64
+}
+
+// Scheduler selects the next task to execute among the tasks accepted by the handler loop, see WithScheduler.
+// Its methods are only called from the handler loop goroutine.
+type Scheduler interface {
+	// Push adds a task accepted by the handler loop
+	Push(task *QueuedTask)
+	// Pop removes and returns the next task to execute, nil when empty
+	Pop() *QueuedTask
+	// Len returns the number of tasks pushed and not popped yet
+	Len() int
+}
+
+// WithScheduler makes sched select the next task to execute instead of the FIFO queue, to implement weighted
+// fairness across task classes for instance. The handler loop takes every task ready to be accepted off the queue and
+// pushes it to sched before popping the next task to execute.
+// sched is used by a single handler: give each handler its own Scheduler. Flush still waits for every task accepted
+// before the call, whatever sched.
+func WithScheduler(sched Scheduler) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.scheduler = sched
+	}
+}
+
+// FIFOScheduler executes the tasks in submission order, as the handler does without scheduler
+type FIFOScheduler struct {
+	queue []*QueuedTask
+}
+
+var _ Scheduler = (*FIFOScheduler)(nil)
+
+// NewFIFOScheduler creates a new FIFOScheduler
+func NewFIFOScheduler() *FIFOScheduler {
+	return &FIFOScheduler{}
+}
+
+// Push adds task at the end of the queue
+func (s *FIFOScheduler) Push(task *QueuedTask) {
+	s.queue = append(s.queue, task)
+}
+
+// Pop removes and returns the oldest task
+func (s *FIFOScheduler) Pop() *QueuedTask {
+	if len(s.queue) == 0 {
+		return nil
+	}
+	task := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return task
+}
+
+// Len returns the number of queued tasks
+func (s *FIFOScheduler) Len() int {
+	return len(s.queue)
+}
+
+// TaskOption configures a single task submission
+type TaskOption func(ctrl *ctrlAction)
+
+// WithClass tags the task with class, for the Scheduler to tell the kinds of tasks apart
+func WithClass(class string) TaskOption {
+	return func(ctrl *ctrlAction) {
+		ctrl.class = class
+	}
+}
+
+// WithOffload executes the task in its own goroutine instead of the handler loop, so that a slow task which does not
+// need to be serialized does not hold the other tasks up. The trade-off is that the task is not serialized anymore: it
+// runs concurrently with the other tasks, so it must not access the state guarded by the handler, unless through
+// its own synchronization or by sending tasks to the handler, which it may do as it does not block the handler loop.
+// The task is still started in order and Close waits for it, but Flush does not.
+func WithOffload() TaskOption {
+	return func(ctrl *ctrlAction) {
+		ctrl.offload = true
+	}
+}
+
+// pendingBarrier is an internal action, a Flush barrier, kept aside from the Scheduler: it is executed once every
+// task accepted before it has been popped, whatever the order the Scheduler selects the tasks in
+type pendingBarrier struct {
+	ctrl *ctrlAction
+	// seq is the sequence number of the last task accepted before the barrier, remaining the number of those tasks
+	// not popped yet
+	seq       uint64
+	remaining int
+}
+
+// nextAction waits for the next task to execute. Returns false once the handler context is done.
+func (h *ThreadSafeActionHandler) nextAction() (*ctrlAction, bool) {
+	if h.scheduler == nil {
+		select {
+		case <-h.handlerCtx().Done():
+			return nil, false
+		case ctrl := <-h.ctrlChannel:
+			return ctrl, true
+		}
+	}
+	if h.handlerCtx().Err() != nil {
+		return nil, false
+	}
+	if h.scheduler.Len() == 0 && len(h.barriers) == 0 {
+		select {
+		case <-h.handlerCtx().Done():
+			return nil, false
+		case ctrl := <-h.ctrlChannel:
+			h.schedule(ctrl)
+		}
+	}
+	for {
+		select {
+		case ctrl := <-h.ctrlChannel:
+			h.schedule(ctrl)
+			continue
+		default:
+		}
+		return h.popScheduled(), true
+	}
+}
+
+// schedule pushes an action taken off the queue to the scheduler, or keeps it aside if it is a barrier
+func (h *ThreadSafeActionHandler) schedule(ctrl *ctrlAction) {
+	if ctrl.internal {
+		h.barriers = append(h.barriers, &pendingBarrier{ctrl: ctrl, seq: h.scheduledSeq, remaining: h.scheduler.Len()})
+		return
+	}
+	h.scheduledSeq++
+	h.scheduler.Push(&QueuedTask{Class: ctrl.class, Sync: ctrl.sync, ctrl: ctrl, seq: h.scheduledSeq})
+}
+
+// popScheduled returns the next action to execute: a barrier once the tasks accepted before it have been popped,
+// the task selected by the scheduler otherwise. Returns nil once both are empty.
+func (h *ThreadSafeActionHandler) popScheduled() *ctrlAction {
+	for i, barrier := range h.barriers {
+		if barrier.remaining == 0 {
+			h.barriers = append(h.barriers[:i], h.barriers[i+1:]...)
+			return barrier.ctrl
+		}
+	}
+	task := h.scheduler.Pop()
+	if task == nil {
+		if len(h.barriers) == 0 {
+			return nil
+		}
+		// The scheduler has lost tasks: the barriers cannot wait for them
+		barrier := h.barriers[0]
+		h.barriers = h.barriers[1:]
+		return barrier.ctrl
+	}
+	for _, barrier := range h.barriers {
+		if task.seq <= barrier.seq {
+			barrier.remaining--
+		}
+	}
+	return task.ctrl
+}
+
+// SynchronousActionSendWithOptions sends an action configured with opts to the thread-safe action handler in a
+// synchronous way. See SynchronousActionSend.
+func (h *ThreadSafeActionHandler) SynchronousActionSendWithOptions(threadSafeTask ThreadSafeTask, args interface{},
+	opts ...TaskOption) (interface{}, error) {
+	if threadSafeTask == nil {
+		return nil, ErrNilTask
+	}
+	return h.sendSync(h.handlerCtx(), threadSafeTask, nil, args, false, opts...)
+}
+
+// AsynchronousActionSendWithOptions sends an action configured with opts to the thread-safe action handler in an
+// asynchronous way. A task rejected by the circuit breaker of its class is reported to the dead-letter hook with
+// ReasonCircuitOpen. See AsynchronousActionSend.
+func (h *ThreadSafeActionHandler) AsynchronousActionSendWithOptions(ctrlThreadSafeFunc ThreadSafeTask, args interface{},
+	opts ...TaskOption) {
+	if ctrlThreadSafeFunc == nil {
+		return
+	}
+	action := h.newAsyncAction(ctrlThreadSafeFunc, args)
+	for _, opt := range opts {
+		opt(action)
+	}
+	if !h.allowClass(action) {
+		h.deadLetter(action, ErrCircuitOpen)
+		return
+	}
+	_ = h.sendAsyncAction(action)
+}
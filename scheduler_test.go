@@ -0,0 +1,159 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+// weightedScheduler serves up to weight tasks of each class in turn, the classes without weight having a weight
+// of 1
+type weightedScheduler struct {
+	classes []string
+	weights map[string]int
+	queues  map[string][]*action.QueuedTask
+	current int
+	served  int
+	len     int
+}
+
+func newWeightedScheduler(weights map[string]int, classes ...string) *weightedScheduler {
+	return &weightedScheduler{classes: classes, weights: weights, queues: map[string][]*action.QueuedTask{}}
+}
+
+func (s *weightedScheduler) Push(task *action.QueuedTask) {
+	if _, known := s.weights[task.Class]; !known {
+		s.classes = append(s.classes, task.Class)
+		s.weights[task.Class] = 1
+	}
+	s.queues[task.Class] = append(s.queues[task.Class], task)
+	s.len++
+}
+
+func (s *weightedScheduler) Pop() *action.QueuedTask {
+	if s.len == 0 {
+		return nil
+	}
+	for {
+		class := s.classes[s.current]
+		if queue := s.queues[class]; len(queue) > 0 && s.served < s.weights[class] {
+			s.queues[class] = queue[1:]
+			s.served++
+			s.len--
+			return queue[0]
+		}
+		s.current = (s.current + 1) % len(s.classes)
+		s.served = 0
+	}
+}
+
+func (s *weightedScheduler) Len() int {
+	return s.len
+}
+
+func Test_ShouldInterleaveTheTaskClassesWithACustomScheduler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	scheduler := newWeightedScheduler(map[string]int{"interactive": 2, "bulk": 1}, "interactive", "bulk")
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(12),
+		action.WithScheduler(scheduler))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	for i := 0; i < 6; i++ {
+		actionHandler.AsynchronousActionSendWithOptions(recordTask(&executed), "b", action.WithClass("bulk"))
+	}
+	for i := 0; i < 6; i++ {
+		actionHandler.AsynchronousActionSendWithOptions(recordTask(&executed), "i", action.WithClass("interactive"))
+	}
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.DeepEqual(t, executed, []interface{}{"i", "i", "b", "i", "i", "b", "i", "i", "b", "b", "b", "b"})
+
+	_, err := actionHandler.SynchronousActionSendWithOptions(recordTask(&executed), "i", action.WithClass("interactive"))
+	assert.NilError(t, err)
+	assert.Equal(t, executed[len(executed)-1], "i")
+}
+
+func Test_ShouldFlushEveryTaskAcceptedBeforeTheCallWhateverTheScheduler(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(8),
+		action.WithScheduler(action.NewFIFOScheduler()))
+	release := blockHandler(actionHandler)
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	flushed := make(chan error)
+	go func() {
+		flushed <- actionHandler.Flush(context.TODO())
+	}()
+	release()
+	assert.NilError(t, <-flushed)
+	_, err := actionHandler.SynchronousActionSend(recordTask(&executed), 4)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, executed, []interface{}{1, 2, 3, 4})
+}
+
+func Test_ShouldNotBlockTheOtherTasksWithAnOffloadedTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowResult := make(chan interface{})
+	go func() {
+		result, _ := actionHandler.SynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			// An offloaded task may send tasks to its own handler
+			return actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+				return "slow", nil
+			}, nil)
+		}, nil, action.WithOffload())
+		slowResult <- result
+	}()
+	<-started
+
+	// The fast task is executed while the offloaded slow task is still running
+	result, err := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return "fast", nil
+	}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, "fast")
+	close(release)
+	assert.Equal(t, <-slowResult, "slow")
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+}
+
+func Test_ShouldWaitForTheOffloadedTasksOnClose(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+
+	release := make(chan struct{})
+	executed := make(chan bool, 1)
+	actionHandler.AsynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+		<-release
+		executed <- true
+		return nil, nil
+	}, nil, action.WithOffload())
+	closed := make(chan error)
+	go func() {
+		closed <- actionHandler.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close should wait for the offloaded task")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	assert.NilError(t, <-closed)
+	assert.Assert(t, <-executed)
+	<-actionHandler.Done()
+}
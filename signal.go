@@ -0,0 +1,57 @@
+package action
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// InstallSignalHandler gracefully shuts h down once one of sigs is received, SIGINT and SIGTERM by default: the
+// tasks already submitted are executed before the handler loop exits, see Close. The outcome of the shutdown is
+// logged. Returns the function uninstalling the signal handler, which can be called several times.
+func InstallSignalHandler(h *ThreadSafeActionHandler, sigs ...os.Signal) func() {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sigs...)
+	uninstall := shutdownOnSignal(h, signals)
+	return func() {
+		signal.Stop(signals)
+		uninstall()
+	}
+}
+
+// shutdownOnSignal gracefully shuts h down once a signal is received on signals, until the returned function is
+// called or the handler is stopped
+func shutdownOnSignal(h *ThreadSafeActionHandler, signals <-chan os.Signal) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			select {
+			case <-stop:
+				// Uninstalled in the meantime
+				return
+			default:
+			}
+			report, err := h.Shutdown(context.Background())
+			if err != nil {
+				h.logf("shutdown on %v failed: %v", sig, err)
+				return
+			}
+			h.logf("shut down on %v: %d tasks drained, %d discarded in %v", sig, report.Drained, report.Discarded,
+				report.Duration)
+		case <-stop:
+		case <-h.Done():
+		}
+	}()
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+	}
+}
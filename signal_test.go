@@ -0,0 +1,51 @@
+package action_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldDrainTheHandlerOnSignal(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO(), action.WithQueueSize(4))
+	signals := make(chan os.Signal, 1)
+	uninstall := action.ShutdownOnSignal(actionHandler, signals)
+	defer uninstall()
+	release := blockHandler(actionHandler)
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+
+	signals <- syscall.SIGTERM
+	for actionHandler.State() != action.Draining {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	<-actionHandler.Done()
+	assert.DeepEqual(t, executed, []interface{}{1, 2, 3})
+}
+
+func Test_ShouldIgnoreTheSignalsOnceUninstalled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	signals := make(chan os.Signal, 1)
+	uninstall := action.ShutdownOnSignal(actionHandler, signals)
+	uninstall()
+	uninstall()
+
+	signals <- syscall.SIGTERM
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, actionHandler.State(), action.Running)
+
+	// The OS signal handler can be installed and uninstalled as well
+	action.InstallSignalHandler(actionHandler, os.Interrupt)()
+	assert.Equal(t, actionHandler.State(), action.Running)
+}
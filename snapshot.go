@@ -0,0 +1,43 @@
+package action
+
+import (
+	"context"
+)
+
+// Snapshotter returns a snapshot of the state owned by the tasks. It is called in the thread-safe context and must
+// copy the state the snapshot tasks read, see SynchronousActionSendWithSnapshot.
+type Snapshotter func() interface{}
+
+// SnapshotTask computes a value from a snapshot taken by a Snapshotter
+type SnapshotTask func(snapshot interface{}) (interface{}, error)
+
+// SynchronousActionSendWithSnapshot takes a snapshot with snapshotter and executes each task against it, all in a
+// single thread-safe task: the tasks see the same consistent state, no other task being executed in between, even
+// though the snapshot owns its data. Returns the task results in order, or the first task error.
+// Returns ErrNilTask if the snapshotter or a task is nil. See SynchronousActionSend.
+func (h *ThreadSafeActionHandler) SynchronousActionSendWithSnapshot(snapshotter Snapshotter, tasks ...SnapshotTask) ([]interface{}, error) {
+	if snapshotter == nil {
+		return nil, ErrNilTask
+	}
+	for _, task := range tasks {
+		if task == nil {
+			return nil, ErrNilTask
+		}
+	}
+	reply, err := h.synchronousSend(h.handlerCtx(), func(context.Context, interface{}) (interface{}, error) {
+		snapshot := snapshotter()
+		results := make([]interface{}, len(tasks))
+		for i, task := range tasks {
+			result, err := task(snapshot)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = result
+		}
+		return results, nil
+	}, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return reply.([]interface{}), nil
+}
@@ -0,0 +1,71 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldRunTheSnapshotTasksAgainstTheSameSnapshot(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	var values []int
+	snapshots := 0
+	snapshotter := func() interface{} {
+		snapshots++
+		return append([]int(nil), values...)
+	}
+	go func() {
+		for i := 0; i < 1000; i++ {
+			actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+				values = append(values, args.(int))
+				return nil, nil
+			}, i)
+		}
+	}()
+	count := func(snapshot interface{}) (interface{}, error) {
+		return len(snapshot.([]int)), nil
+	}
+	sum := func(snapshot interface{}) (interface{}, error) {
+		total := 0
+		for _, value := range snapshot.([]int) {
+			total += value
+		}
+		return total, nil
+	}
+	for i := 0; i < 50; i++ {
+		results, err := actionHandler.SynchronousActionSendWithSnapshot(snapshotter, count, sum)
+		assert.NilError(t, err)
+		// The values are 0, 1, ..., n-1 in the snapshot of n values
+		n := results[0].(int)
+		assert.Equal(t, results[1], n*(n-1)/2)
+	}
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+	assert.Equal(t, snapshots, 50)
+}
+
+func Test_ShouldReturnTheFirstSnapshotTaskError(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	snapshotter := func() interface{} {
+		return nil
+	}
+	failure := errors.New("failure")
+	failing := func(interface{}) (interface{}, error) {
+		return nil, failure
+	}
+
+	_, err := actionHandler.SynchronousActionSendWithSnapshot(snapshotter, failing)
+	assert.Assert(t, errors.Is(err, failure))
+	_, err = actionHandler.SynchronousActionSendWithSnapshot(nil, failing)
+	assert.Assert(t, errors.Is(err, action.ErrNilTask))
+	_, err = actionHandler.SynchronousActionSendWithSnapshot(snapshotter, nil)
+	assert.Assert(t, errors.Is(err, action.ErrNilTask))
+}
@@ -0,0 +1,101 @@
+package action
+
+import (
+	"sync/atomic"
+)
+
+// HandlerState is the lifecycle state of a handler, see State
+type HandlerState int32
+
+const (
+	// Running is the state of a handler executing its tasks
+	Running HandlerState = iota
+	// Paused is the state of a handler accepting tasks without starting them, see Pause
+	Paused
+	// Draining is the state of a handler being shut down: it rejects new tasks and executes the ones already
+	// submitted, see Shutdown
+	Draining
+	// Closed is the state of a handler whose loop has exited, once shut down or its context done
+	Closed
+)
+
+func (s HandlerState) String() string {
+	switch s {
+	case Paused:
+		return "paused"
+	case Draining:
+		return "draining"
+	case Closed:
+		return "closed"
+	default:
+		return "running"
+	}
+}
+
+// State returns the current lifecycle state of the handler. A restarted handler is running again, see Restart.
+func (h *ThreadSafeActionHandler) State() HandlerState {
+	return HandlerState(atomic.LoadInt32(&h.current().state))
+}
+
+// Pause stops the handler loop from starting new tasks until Resume is called: the running task completes, while
+// the tasks submitted meanwhile are queued. Flush and WaitIdle wait for the handler to be resumed as well.
+// Returns false if the handler is not running.
+func (h *ThreadSafeActionHandler) Pause() bool {
+	life := h.current()
+	life.pauseMutex.Lock()
+	defer life.pauseMutex.Unlock()
+	if !atomic.CompareAndSwapInt32(&life.state, int32(Running), int32(Paused)) {
+		return false
+	}
+	life.resumed = make(chan struct{})
+	return true
+}
+
+// Resume lets a paused handler loop start the queued tasks again. Returns false if the handler is not paused.
+func (h *ThreadSafeActionHandler) Resume() bool {
+	life := h.current()
+	life.pauseMutex.Lock()
+	defer life.pauseMutex.Unlock()
+	if !atomic.CompareAndSwapInt32(&life.state, int32(Paused), int32(Running)) {
+		return false
+	}
+	close(life.resumed)
+	return true
+}
+
+// startDraining moves the handler to the Draining state, resuming it if paused so that the drain completes
+func (life *lifecycle) startDraining() {
+	life.pauseMutex.Lock()
+	defer life.pauseMutex.Unlock()
+	state := atomic.LoadInt32(&life.state)
+	if state == int32(Closed) {
+		return
+	}
+	if state == int32(Paused) {
+		close(life.resumed)
+	}
+	atomic.StoreInt32(&life.state, int32(Draining))
+}
+
+// markClosed moves the handler to the Closed state once its loop has exited
+func (life *lifecycle) markClosed() {
+	life.pauseMutex.Lock()
+	defer life.pauseMutex.Unlock()
+	atomic.StoreInt32(&life.state, int32(Closed))
+}
+
+// awaitResume waits for a paused handler to be resumed. Returns false once the handler context is done.
+func (life *lifecycle) awaitResume() bool {
+	if atomic.LoadInt32(&life.state) != int32(Paused) {
+		return true
+	}
+	life.pauseMutex.Lock()
+	resumed := life.resumed
+	life.pauseMutex.Unlock()
+	select {
+	case <-resumed:
+		return true
+	case <-life.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldGoThroughTheLifecycleStates(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO(), action.WithQueueSize(4))
+	assert.Equal(t, actionHandler.State(), action.Running)
+
+	assert.Assert(t, actionHandler.Pause())
+	assert.Equal(t, actionHandler.State(), action.Paused)
+	assert.Assert(t, !actionHandler.Pause())
+	executed := make(chan bool, 1)
+	actionHandler.AsynchronousActionSend(func(interface{}) (interface{}, error) {
+		executed <- true
+		return nil, nil
+	}, nil)
+	select {
+	case <-executed:
+		t.Fatal("a paused handler should not start the tasks")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Assert(t, actionHandler.Resume())
+	assert.Equal(t, actionHandler.State(), action.Running)
+	assert.Assert(t, !actionHandler.Resume())
+	assert.Assert(t, <-executed)
+
+	release := blockHandler(actionHandler)
+	shutdown := make(chan error)
+	go func() {
+		_, err := actionHandler.Shutdown(context.TODO())
+		shutdown <- err
+	}()
+	for actionHandler.State() != action.Draining {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Assert(t, !actionHandler.Pause())
+	release()
+	assert.NilError(t, <-shutdown)
+	<-actionHandler.Done()
+	assert.Equal(t, actionHandler.State(), action.Closed)
+
+	assert.NilError(t, actionHandler.Restart(context.TODO()))
+	assert.Equal(t, actionHandler.State(), action.Running)
+	assert.NilError(t, actionHandler.Close())
+}
+
+func Test_ShouldDrainAPausedHandlerOnShutdown(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO(), action.WithQueueSize(4))
+	assert.Assert(t, actionHandler.Pause())
+	var executed []interface{}
+	actionHandler.AsynchronousActionSend(recordTask(&executed), 1)
+
+	report, err := actionHandler.Shutdown(context.TODO())
+	assert.NilError(t, err)
+	assert.Equal(t, report.Drained, 1)
+	assert.DeepEqual(t, executed, []interface{}{1})
+	<-actionHandler.Done()
+	assert.Equal(t, actionHandler.State(), action.Closed)
+}
+
+func Test_ShouldCloseAPausedHandlerWhenItsContextIsCancelled(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	assert.Assert(t, actionHandler.Pause())
+	cancelHandler()
+	<-actionHandler.Done()
+	assert.Equal(t, actionHandler.State(), action.Closed)
+	assert.Equal(t, actionHandler.State().String(), "closed")
+}
@@ -0,0 +1,29 @@
+package action
+
+// StateGuard binds a state value to a ThreadSafeActionHandler: the value is only accessed from thread-safe
+// tasks, without having to write the task closure and the args boxing for each operation.
+// Several StateGuards can share the same handler, their operations are then serialized together.
+type StateGuard[T any] struct {
+	handler *ThreadSafeActionHandler
+	state   T
+}
+
+// NewStateGuard creates a new StateGuard protecting state with the given handler
+func NewStateGuard[T any](handler *ThreadSafeActionHandler, state T) *StateGuard[T] {
+	return &StateGuard[T]{
+		handler: handler,
+		state:   state,
+	}
+}
+
+// Do executes fn in the handler thread-safe context with a pointer to the guarded state.
+// The pointer must not be retained outside of fn.
+// Returns the fn result
+func (g *StateGuard[T]) Do(fn func(state *T) (interface{}, error)) (interface{}, error) {
+	if fn == nil {
+		return nil, ErrNilTask
+	}
+	return g.handler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+		return fn(&g.state)
+	}, nil)
+}
@@ -0,0 +1,61 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldShareAHandlerBetweenSeveralStateGuards(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	counter := action.NewStateGuard(actionHandler, 0)
+	names := action.NewStateGuard(actionHandler, map[int]string{})
+
+	nbConc := 100
+	allDone := make(chan error, 2*nbConc)
+	for i := 0; i < nbConc; i++ {
+		go func(i int) {
+			_, err := counter.Do(func(count *int) (interface{}, error) {
+				*count++
+				return nil, nil
+			})
+			allDone <- err
+		}(i)
+		go func(i int) {
+			_, err := names.Do(func(byID *map[int]string) (interface{}, error) {
+				(*byID)[i] = "name"
+				return nil, nil
+			})
+			allDone <- err
+		}(i)
+	}
+	for i := 0; i < 2*nbConc; i++ {
+		assert.NilError(t, <-allDone)
+	}
+
+	count, err := counter.Do(func(count *int) (interface{}, error) {
+		return *count, nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, count, nbConc)
+	nbNames, err := names.Do(func(byID *map[int]string) (interface{}, error) {
+		return len(*byID), nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, nbNames, nbConc)
+}
+
+func Test_ShouldRejectNilStateGuardOperation(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	counter := action.NewStateGuard(action.NewThreadSafeActionHandler(handlerCtx), 0)
+
+	_, err := counter.Do(nil)
+	assert.Equal(t, err, action.ErrNilTask)
+}
@@ -0,0 +1,34 @@
+package action
+
+// The tests control when the handler loop takes the next action through the step channels: the loop waits for a
+// value on step before taking an action, then sends a value on stepped once the action has been dispatched.
+
+// withStepper makes the handler loop wait for a value on step before taking each action, and send a value on
+// stepped once it has been dispatched
+func withStepper(step, stepped chan struct{}) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.step = step
+		h.stepped = stepped
+	}
+}
+
+// awaitStep waits for the tests to allow the handler loop to take the next action, if stepping.
+// Returns false once the handler context is done.
+func (h *ThreadSafeActionHandler) awaitStep() bool {
+	if h.step == nil {
+		return true
+	}
+	select {
+	case <-h.step:
+		return true
+	case <-h.handlerCtx().Done():
+		return false
+	}
+}
+
+// stepDone notifies the tests that the action allowed by the last step has been dispatched, if stepping
+func (h *ThreadSafeActionHandler) stepDone() {
+	if h.stepped != nil {
+		h.stepped <- struct{}{}
+	}
+}
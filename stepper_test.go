@@ -0,0 +1,43 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldExecuteOneTaskPerStep(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	stepper := action.NewStepper()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(4),
+		action.WithStepper(stepper))
+
+	var executed []interface{}
+	for i := 1; i <= 3; i++ {
+		actionHandler.AsynchronousActionSend(recordTask(&executed), i)
+	}
+	assert.Equal(t, actionHandler.Len(), 3)
+	stepper.StepNext()
+	assert.DeepEqual(t, executed, []interface{}{1})
+	assert.Equal(t, actionHandler.Len(), 2)
+	stepper.StepNext()
+	assert.DeepEqual(t, executed, []interface{}{1, 2})
+	stepper.StepNext()
+	assert.DeepEqual(t, executed, []interface{}{1, 2, 3})
+	assert.Equal(t, actionHandler.Len(), 0)
+
+	// A step waits for the next task to be submitted
+	result := make(chan interface{})
+	go func() {
+		value, _ := actionHandler.SynchronousActionSend(func(interface{}) (interface{}, error) {
+			return "done", nil
+		}, nil)
+		result <- value
+	}()
+	stepper.StepNext()
+	assert.Equal(t, <-result, "done")
+}
@@ -0,0 +1,79 @@
+package action
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Result is the outcome of the task at Index in a SendStream call
+type Result struct {
+	Index int
+	Value interface{}
+	Err   error
+}
+
+// SendStream sends the tasks asynchronously, tasks[i] with args[i], and returns a channel receiving their results in
+// submission order as they complete. The channel is closed once every task has been executed or discarded. args may
+// be nil to execute every task with nil args.
+// A nil task is not sent, its result carrying ErrNilTask. No task is sent when args and tasks lengths differ, every
+// result carrying the error.
+func (h *ThreadSafeActionHandler) SendStream(tasks []ThreadSafeTask, args []interface{}) <-chan Result {
+	// The channel is buffered for every result: the handler loop never waits for the receiver
+	results := make(chan Result, len(tasks))
+	stream := &resultStream{results: results, pending: make([]*Result, len(tasks))}
+	if len(tasks) == 0 {
+		close(results)
+		return results
+	}
+	if args != nil && len(args) != len(tasks) {
+		err := fmt.Errorf("thread-safe action handler: %d tasks sent with %d args", len(tasks), len(args))
+		for i := range tasks {
+			stream.complete(Result{Index: i, Err: err})
+		}
+		return results
+	}
+	for i, task := range tasks {
+		if task == nil {
+			stream.complete(Result{Index: i, Err: ErrNilTask})
+			continue
+		}
+		var taskArgs interface{}
+		if args != nil {
+			taskArgs = args[i]
+		}
+		i := i
+		action := h.newAsyncAction(task, taskArgs)
+		action.onDone = func(reply taskReply, _ bool) {
+			stream.complete(Result{Index: i, Value: reply.result, Err: reply.err})
+		}
+		if err := h.sendAsyncAction(action); err != nil {
+			action.onDone(taskReply{err: err}, false)
+		}
+	}
+	return results
+}
+
+// resultStream sends the results of a SendStream call in submission order, whatever the order they complete in:
+// a task evicted by the full queue policy completes before the tasks queued ahead of it for instance
+type resultStream struct {
+	mutex   sync.Mutex
+	results chan Result
+	// pending holds the completed results waiting for the ones ahead of them, next is the index of the next result
+	// to send
+	pending []*Result
+	next    int
+}
+
+func (s *resultStream) complete(result Result) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[result.Index] = &result
+	for s.next < len(s.pending) && s.pending[s.next] != nil {
+		s.results <- *s.pending[s.next]
+		s.pending[s.next] = nil
+		s.next++
+	}
+	if s.next == len(s.pending) {
+		close(s.results)
+	}
+}
@@ -0,0 +1,79 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldStreamTheTaskResultsInSubmissionOrder(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	taskErr := errors.New("task error")
+
+	double := func(args interface{}) (interface{}, error) {
+		return args.(int) * 2, nil
+	}
+	failing := func(interface{}) (interface{}, error) {
+		return nil, taskErr
+	}
+	results := actionHandler.SendStream([]action.ThreadSafeTask{double, failing, nil, double}, []interface{}{1, 2, 3, 4})
+
+	var received []action.Result
+	for result := range results {
+		received = append(received, result)
+	}
+	assert.Equal(t, len(received), 4)
+	for i, result := range received {
+		assert.Equal(t, result.Index, i)
+	}
+	assert.NilError(t, received[0].Err)
+	assert.Equal(t, received[0].Value, 2)
+	assert.Assert(t, errors.Is(received[1].Err, taskErr))
+	assert.Equal(t, received[2].Err, action.ErrNilTask)
+	assert.NilError(t, received[3].Err)
+	assert.Equal(t, received[3].Value, 8)
+}
+
+func Test_ShouldStreamTheResultsInSubmissionOrderWhateverTheExecutionOrder(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(3),
+		action.WithExecutionOrder(action.LIFO))
+	release := blockHandler(actionHandler)
+
+	identity := func(args interface{}) (interface{}, error) {
+		return args, nil
+	}
+	results := actionHandler.SendStream([]action.ThreadSafeTask{identity, identity, identity}, nil)
+	release()
+	index := 0
+	for result := range results {
+		assert.Equal(t, result.Index, index)
+		index++
+	}
+	assert.Equal(t, index, 3)
+}
+
+func Test_ShouldCloseTheStreamOfInvalidTasks(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	_, open := <-actionHandler.SendStream(nil, nil)
+	assert.Assert(t, !open)
+	var executed []interface{}
+	for result := range actionHandler.SendStream([]action.ThreadSafeTask{recordTask(&executed)}, []interface{}{1, 2}) {
+		assert.ErrorContains(t, result.Err, "1 tasks sent with 2 args")
+	}
+	assert.NilError(t, actionHandler.Close())
+	for result := range actionHandler.SendStream([]action.ThreadSafeTask{recordTask(&executed)}, nil) {
+		assert.Assert(t, errors.Is(result.Err, action.ErrHandlerClosed))
+	}
+	assert.Equal(t, len(executed), 0)
+}
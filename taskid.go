@@ -0,0 +1,40 @@
+package action
+
+// WithID tags the task with a correlation ID, included in the handler logs and in the ActionError of the task, and
+// given to the identified panic and dead-letter hooks, see WithIdentifiedPanicHandler and WithIdentifiedDeadLetter
+func WithID(id string) TaskOption {
+	return func(c *ctrlAction) {
+		c.id = id
+	}
+}
+
+// AsynchronousActionSendWithID sends an action tagged with the correlation ID id to the thread-safe action handler
+// in an asynchronous way. See WithID and AsynchronousActionSend.
+func (h *ThreadSafeActionHandler) AsynchronousActionSendWithID(id string, ctrlThreadSafeFunc ThreadSafeTask, args interface{}) {
+	h.AsynchronousActionSendWithOptions(ctrlThreadSafeFunc, args, WithID(id))
+}
+
+// WithIdentifiedPanicHandler is WithPanicHandler with onPanic also receiving the correlation ID of the task, empty
+// for a task sent without ID, see WithID
+func WithIdentifiedPanicHandler(onPanic func(id string, recovered interface{}, stack []byte)) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.onPanic = onPanic
+	}
+}
+
+// WithIdentifiedDeadLetter is WithDeadLetter with onDiscard also receiving the correlation ID of the task, empty
+// for a task sent without ID, see WithID
+func WithIdentifiedDeadLetter(onDiscard func(id string, task ThreadSafeTask, args interface{}, reason DiscardReason)) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.onDeadLetter = onDiscard
+	}
+}
+
+// logTaskf logs a message about a task, prefixed with its correlation ID if any
+func (h *ThreadSafeActionHandler) logTaskf(ctrl *ctrlAction, format string, args ...interface{}) {
+	if ctrl.id != "" {
+		format = "task %q: " + format
+		args = append([]interface{}{ctrl.id}, args...)
+	}
+	h.logf(format, args...)
+}
@@ -0,0 +1,67 @@
+package action_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldLogTheCorrelationIDOfAPanickingTask(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+
+	actionHandler.AsynchronousActionSendWithID("request-42", func(interface{}) (interface{}, error) {
+		panic("something wrong happened")
+	}, nil)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	assert.Assert(t, strings.Contains(logs.String(), `task "request-42": thread-safe task panicked: something wrong happened`))
+}
+
+func Test_ShouldReportTheCorrelationIDInTheTaskErrorAndHooks(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	panicked := make(chan string, 1)
+	discarded := make(chan string, 1)
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithQueueSize(1),
+		action.WithFullQueuePolicy(action.QueueDropNewest),
+		action.WithIdentifiedPanicHandler(func(id string, recovered interface{}, stack []byte) {
+			panicked <- id
+		}),
+		action.WithIdentifiedDeadLetter(func(id string, task action.ThreadSafeTask, args interface{}, reason action.DiscardReason) {
+			discarded <- id
+		}))
+
+	_, err := actionHandler.SynchronousActionSendWithOptions(func(interface{}) (interface{}, error) {
+		return nil, errors.New("failure")
+	}, nil, action.WithID("request-1"))
+	var actionErr *action.ActionError
+	assert.Assert(t, errors.As(err, &actionErr))
+	assert.Equal(t, actionErr.ID, "request-1")
+	assert.ErrorContains(t, err, `synchronous "request-1" thread-safe task failed`)
+
+	actionHandler.AsynchronousActionSendWithID("request-2", func(interface{}) (interface{}, error) {
+		panic("something wrong happened")
+	}, nil)
+	assert.Equal(t, <-panicked, "request-2")
+
+	release := blockHandler(actionHandler)
+	var executed []interface{}
+	actionHandler.AsynchronousActionSendWithID("request-3", recordTask(&executed), nil)
+	actionHandler.AsynchronousActionSendWithID("request-4", recordTask(&executed), nil)
+	assert.Equal(t, <-discarded, "request-4")
+	release()
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+}
@@ -0,0 +1,31 @@
+package action
+
+import (
+	"context"
+)
+
+// TaskSpanName is the name of the span started around each task execution
+const TaskSpanName = "threadsafe.task"
+
+// Span is the part of a tracing span used by the handler
+type Span interface {
+	// RecordError marks the span as failed with err
+	RecordError(err error)
+	// End completes the span
+	End()
+}
+
+// Tracer starts the spans of the executed tasks.
+// It keeps the core package free of any tracing dependency: an OpenTelemetry trace.Tracer is plugged with a small
+// adapter whose Start calls the OpenTelemetry one and whose span RecordError also sets the span status to error.
+type Tracer interface {
+	// Start starts a span named spanName, child of the span in ctx if any
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// WithTracer traces each task execution with a span named TaskSpanName, recording the task error if any
+func WithTracer(tracer Tracer) Option {
+	return func(h *ThreadSafeActionHandler) {
+		h.tracer = tracer
+	}
+}
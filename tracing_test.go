@@ -0,0 +1,103 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+type fakeSpan struct {
+	parent context.Context
+	name   string
+	err    error
+	ended  bool
+}
+
+func (s *fakeSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *fakeSpan) End() {
+	s.ended = true
+}
+
+type fakeTracer struct {
+	mutex sync.Mutex
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(ctx context.Context, spanName string) (context.Context, action.Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	span := &fakeSpan{parent: ctx, name: spanName}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, fakeSpanKey{}, span), span
+}
+
+type fakeSpanKey struct{}
+
+func (t *fakeTracer) getSpans() []fakeSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var spans []fakeSpan
+	for _, span := range t.spans {
+		spans = append(spans, *span)
+	}
+	return spans
+}
+
+func Test_ShouldStartOneSpanPerTask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	tracer := &fakeTracer{}
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithTracer(tracer))
+
+	taskErr := errors.New("something wrong happened")
+	_, err := actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, err)
+	_, err = actionHandler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, taskErr
+	}, nil)
+	assert.Assert(t, errors.Is(err, taskErr))
+	actionHandler.AsynchronousActionSend(func(args interface{}) (interface{}, error) {
+		return nil, nil
+	}, nil)
+	assert.NilError(t, actionHandler.WaitIdle(context.TODO()))
+
+	expectedErrors := []error{nil, taskErr, nil}
+	spans := tracer.getSpans()
+	assert.Equal(t, len(spans), len(expectedErrors))
+	for i, span := range spans {
+		assert.Equal(t, span.name, action.TaskSpanName)
+		assert.Equal(t, span.err, expectedErrors[i])
+		assert.Assert(t, span.ended)
+	}
+}
+
+type requestIDKey struct{}
+
+func Test_ShouldUseTheCallContextAsSpanParent(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	tracer := &fakeTracer{}
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx, action.WithTracer(tracer))
+
+	callCtx := context.WithValue(context.TODO(), requestIDKey{}, "request-1")
+	taskSpan, err := actionHandler.SynchronousActionSendCtx(callCtx, func(ctx context.Context, args interface{}) (interface{}, error) {
+		return ctx.Value(fakeSpanKey{}), nil
+	}, nil)
+	assert.NilError(t, err)
+
+	spans := tracer.getSpans()
+	assert.Equal(t, len(spans), 1)
+	assert.Equal(t, spans[0].parent.Value(requestIDKey{}), "request-1")
+	// The task is executed in the span context
+	assert.Equal(t, taskSpan.(*fakeSpan).name, action.TaskSpanName)
+}
@@ -0,0 +1,31 @@
+package action
+
+// pair boxes the two results of a task returning two values
+type pair[R1, R2 any] struct {
+	first  R1
+	second R2
+}
+
+// SynchronousActionSend2 sends a task returning two values to the handler in a synchronous way, without having
+// to box the values in a struct and type-assert the result.
+// Returns the zero values with the task error, or with the handler error. See SynchronousActionSend.
+func SynchronousActionSend2[R1, R2 any](handler ThreadSafeActionHandlerIft,
+	threadSafeTask func(args interface{}) (R1, R2, error), args interface{}) (R1, R2, error) {
+	var first R1
+	var second R2
+	if threadSafeTask == nil {
+		return first, second, ErrNilTask
+	}
+	result, err := handler.SynchronousActionSend(func(args interface{}) (interface{}, error) {
+		r1, r2, err := threadSafeTask(args)
+		if err != nil {
+			return nil, err
+		}
+		return pair[R1, R2]{first: r1, second: r2}, nil
+	}, args)
+	if err != nil {
+		return first, second, err
+	}
+	values := result.(pair[R1, R2])
+	return values.first, values.second, nil
+}
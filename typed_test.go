@@ -0,0 +1,63 @@
+package action_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+
+	action "github.com/sbracaloni/thread-safe-action"
+)
+
+func Test_ShouldReturnTheTwoValuesOfATask(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	ids := map[string]int{"foo": 1}
+
+	id, found, err := action.SynchronousActionSend2(actionHandler, func(args interface{}) (int, bool, error) {
+		id, found := ids[args.(string)]
+		return id, found, nil
+	}, "foo")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+	assert.Equal(t, found, true)
+
+	id, found, err = action.SynchronousActionSend2(actionHandler, func(args interface{}) (int, bool, error) {
+		id, found := ids[args.(string)]
+		return id, found, nil
+	}, "bar")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 0)
+	assert.Equal(t, found, false)
+}
+
+func Test_ShouldReturnZeroValuesWithTheTaskError(t *testing.T) {
+	handlerCtx, cancelHandler := context.WithCancel(context.TODO())
+	defer cancelHandler()
+	actionHandler := action.NewThreadSafeActionHandler(handlerCtx)
+	taskErr := errors.New("task error")
+
+	name, count, err := action.SynchronousActionSend2(actionHandler, func(interface{}) (string, int, error) {
+		return "ignored", 3, taskErr
+	}, nil)
+	assert.Assert(t, errors.Is(err, taskErr))
+	assert.Equal(t, name, "")
+	assert.Equal(t, count, 0)
+}
+
+func Test_ShouldReturnZeroValuesWithTheHandlerError(t *testing.T) {
+	actionHandler := action.NewThreadSafeActionHandler(context.TODO())
+	assert.NilError(t, actionHandler.Close())
+
+	name, count, err := action.SynchronousActionSend2(actionHandler, func(interface{}) (string, int, error) {
+		return "ignored", 3, nil
+	}, nil)
+	assert.Assert(t, errors.Is(err, action.ErrHandlerClosed))
+	assert.Equal(t, name, "")
+	assert.Equal(t, count, 0)
+
+	_, _, err = action.SynchronousActionSend2[string, int](actionHandler, nil, nil)
+	assert.Equal(t, err, action.ErrNilTask)
+}